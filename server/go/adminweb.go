@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName = "mortalnet_session"
+	sessionTTL        = 30 * time.Minute
+	sessionSweepEvery = time.Minute
+)
+
+// webSession is server-side session state for one logged-in admin.
+// Sessions are purely a web-layer concern (not hub state), so they're kept
+// behind their own mutex rather than routed through the hub's event loop.
+type webSession struct {
+	csrfToken string
+	expiry    time.Time
+}
+
+// sessionStore issues and validates admin sessions. Cookie values are
+// "<id>.<hmac>" so a forged id is rejected without a map lookup, and a TTL
+// sweeper reaps expired sessions so the map doesn't grow unbounded.
+type sessionStore struct {
+	secret []byte // HMAC-SHA256 key, generated fresh per process
+
+	mu       sync.Mutex
+	sessions map[string]*webSession
+}
+
+func newSessionStore() *sessionStore {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		// crypto/rand failing means the system entropy source is broken;
+		// there's nothing safer to fall back to.
+		panic("adminweb: failed to generate session secret: " + err.Error())
+	}
+	return &sessionStore{secret: secret, sessions: make(map[string]*webSession)}
+}
+
+func (s *sessionStore) sign(id string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// create starts a new session and returns the cookie value to hand back to
+// the browser along with the session's CSRF token.
+func (s *sessionStore) create() (cookieValue, csrfToken string) {
+	id := randomToken()
+	csrfToken = randomToken()
+
+	s.mu.Lock()
+	s.sessions[id] = &webSession{csrfToken: csrfToken, expiry: time.Now().Add(sessionTTL)}
+	s.mu.Unlock()
+
+	return id + "." + s.sign(id), csrfToken
+}
+
+// validate checks a cookie value and returns the live session behind it.
+func (s *sessionStore) validate(cookieValue string) (*webSession, bool) {
+	id, sig, ok := strings.Cut(cookieValue, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(id))) {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(sess.expiry) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	return sess, true
+}
+
+// sweep drops expired sessions. Run periodically from RunWebServer.
+func (s *sessionStore) sweep() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		if now.After(sess.expiry) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("adminweb: failed to generate random token: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+const loginFormHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>MortalNet Admin Login</title>
+<style>
+  body { font-family: monospace; background: #111; color: #ccc; padding: 2em; }
+  h1 { color: #f80; }
+  input { font-family: monospace; padding: 0.4em; }
+  .error { color: #f88; }
+</style>
+</head>
+<body>
+<h1>MortalNet Admin Login</h1>
+%s
+<form method="post" action="/login">
+<input type="password" name="password" placeholder="admin password" autofocus>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>`
+
+const adminConsoleHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="csrf-token" content="%s">
+<title>MortalNet Admin Console</title>
+<style>
+  body { font-family: monospace; background: #111; color: #ccc; padding: 2em; }
+  h1 { color: #f80; }
+  label { display: block; margin-top: 1em; }
+  input, textarea { font-family: monospace; padding: 0.4em; width: 24em; }
+  button { font-family: monospace; padding: 0.4em 0.8em; margin-top: 0.5em; }
+  #result { color: #8f8; margin-top: 1em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>MortalNet Admin Console</h1>
+<label>Kick/Ban/Unban target (nick or IP) <input id="target"></label>
+<label>MOTD / broadcast text <input id="text"></label>
+<button onclick="act('kick')">Kick</button>
+<button onclick="act('ban')">Ban</button>
+<button onclick="act('unban')">Unban</button>
+<button onclick="act('motd')">Set MOTD</button>
+<button onclick="act('broadcast')">Broadcast</button>
+<pre id="result"></pre>
+<script>
+var csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+function act(kind) {
+  fetch("/api/" + kind, {
+    method: "POST",
+    headers: {"Content-Type": "application/json", "X-CSRF-Token": csrfToken},
+    body: JSON.stringify({target: document.getElementById("target").value,
+                           text: document.getElementById("text").value}),
+  }).then(function (r) { return r.json().then(function (j) { return {status: r.status, body: j}; }); })
+    .then(function (r) { document.getElementById("result").textContent = JSON.stringify(r.body, null, 2); });
+}
+</script>
+</body>
+</html>`
+
+// serveLogin handles both the login form (GET) and its submission (POST).
+// On success it sets an HMAC-signed, HttpOnly session cookie and serves the
+// admin console with that session's CSRF token embedded for mutation calls.
+func serveLogin(cfg *Config, store *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if cfg.AdminPassword == "" {
+			http.Error(w, "Admin console is disabled on this server.", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, loginFormHTML, "")
+
+		case http.MethodPost:
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "bad form", http.StatusBadRequest)
+				return
+			}
+			if r.FormValue("password") != cfg.AdminPassword {
+				slog.Warn("failed web admin login", "remote", r.RemoteAddr)
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				fmt.Fprintf(w, loginFormHTML, `<p class="error">Invalid password.</p>`)
+				return
+			}
+
+			cookieValue, csrfToken := store.create()
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookieName,
+				Value:    cookieValue,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+				MaxAge:   int(sessionTTL.Seconds()),
+			})
+			slog.Info("web admin logged in", "remote", r.RemoteAddr)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, adminConsoleHTML, csrfToken)
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// requireAdminSession wraps an admin mutation handler: it requires a valid
+// session cookie and (since all these endpoints mutate state) a matching
+// CSRF token in the X-CSRF-Token header.
+func requireAdminSession(store *sessionStore, fn func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil {
+			http.Error(w, "not logged in", http.StatusUnauthorized)
+			return
+		}
+		sess, ok := store.validate(cookie.Value)
+		if !ok {
+			http.Error(w, "session expired or invalid", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-CSRF-Token") != sess.csrfToken {
+			http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		fn(w, r)
+	}
+}
+
+type adminMutationRequest struct {
+	Target string `json:"target"`
+	Text   string `json:"text"`
+}
+
+// makeAdminMutationHandler dispatches an AdminCommand of the given kind into
+// the hub's event channel and waits for its AdminResult, mirroring the
+// chat-originated 'A' admin commands.
+func makeAdminMutationHandler(hub *Hub, store *sessionStore, kind string) http.HandlerFunc {
+	return requireAdminSession(store, func(w http.ResponseWriter, r *http.Request) {
+		var req adminMutationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request body", http.StatusBadRequest)
+			return
+		}
+
+		remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+		reply := make(chan AdminResult, 1)
+		hub.events <- HubEvent{
+			Type: EventAdminCommand,
+			Admin: &AdminCommand{
+				Kind:      kind,
+				Target:    req.Target,
+				Text:      req.Text,
+				ActorNick: "webadmin",
+				ActorIP:   remoteIP,
+				Reply:     reply,
+			},
+		}
+		result := <-reply
+
+		slog.Info("web admin action", "action", kind, "remoteIP", remoteIP, "ok", result.OK)
+		w.Header().Set("Content-Type", "application/json")
+		if !result.OK {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// runSessionSweeper periodically reaps expired admin sessions until ctx is
+// cancelled.
+func runSessionSweeper(ctx context.Context, store *sessionStore) {
+	ticker := time.NewTicker(sessionSweepEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			store.sweep()
+		}
+	}
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log/slog"
-	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,40 +13,77 @@ import (
 
 const (
 	maxLineBytes = 1024
-	sendBufSize  = 64             // outbound channel buffer; full → disconnect
 	idleTimeout  = 5 * time.Minute
 	writeTimeout = 30 * time.Second
 )
 
 var clientIDCounter uint64
 
+// lineConn is the minimal connection surface Client needs: newline-framed
+// reads/writes, deadlines, and close. net.Conn satisfies it directly, so
+// raw TCP and TLS need no adapter; wsConn (see ws.go) adapts a WebSocket
+// connection to look the same way so the hub never has to know which
+// transport a given peer is using.
+type lineConn interface {
+	Read(b []byte) (int, error)
+	Write(b []byte) (int, error)
+	Close() error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
 // Client holds all state for a single connected client.
 type Client struct {
 	id           uint64
 	ip           string
-	conn         net.Conn
-	send         chan string // outbound message queue; closed by hub on leave
+	conn         lineConn
+	queue        *sendQueue // outbound message queue; closed by hub on leave (see sendqueue.go)
 	joinedAt     time.Time
 
 	mu           sync.Mutex  // protects the fields below
 	nick         string
 	confirmed    bool
 	lastActivity time.Time
+	// status is one of ValidStatus's values ("chat", "away", "game",
+	// "queue"), set to "chat" once confirmed and updated via 'T' (see
+	// onStatus in server.go).
+	status string
 
-	// token bucket (protected by mu; initialised by hub in handleJoin)
+	// opName is the operator account name this client authenticated as via
+	// 'E', or "" if unauthenticated; see operators.go.
+	opName string
+
+	// token bucket (protected by mu; initialised by hub in handleJoin,
+	// charged by the hub's RateLimiter — see ratelimit.go)
 	tokens    float64
 	tokenLast time.Time
 	strikes   int
+	// mutedUntil holds off all rate-limited traffic until it elapses; set by
+	// WeightedRateLimiter.Allow when strikes escalate past the warn-only
+	// band. Zero value means "not muted".
+	mutedUntil time.Time
+
+	// Multiline batch in progress, if any; see onBatch in server.go. The
+	// whole batch costs one RateLimiter.Allow charge (at Bend), not one per line.
+	batchActive bool
+	batchLines  []string
+	batchBytes  int
+
+	// framer is the wire framing this client currently speaks: LineFramer
+	// until (and unless) it switches to LengthPrefixFramer via the 'X'
+	// command (see onSwitchFramer in server.go and framer.go).
+	framer Framer
 }
 
-func newClient(conn net.Conn, ip string) *Client {
+func newClient(conn lineConn, ip string, cfg *Config) *Client {
 	return &Client{
 		id:           atomic.AddUint64(&clientIDCounter, 1),
 		ip:           ip,
 		conn:         conn,
-		send:         make(chan string, sendBufSize),
+		queue:        newSendQueue(cfg.SendQueueSize, cfg.SendQueueHighWater, cfg.SendQueueLowWater),
 		joinedAt:     time.Now(),
 		lastActivity: time.Now(),
+		framer:       LineFramer{},
 	}
 }
 
@@ -57,9 +95,7 @@ func (c *Client) readPump(hub *Hub, cfg *Config) {
 		hub.events <- HubEvent{Type: EventLeave, Client: c}
 	}()
 
-	scanner := bufio.NewScanner(c.conn)
-	scanner.Buffer(make([]byte, maxLineBytes+2), maxLineBytes+2)
-	scanner.Split(scanLines)
+	br := bufio.NewReaderSize(c.conn, maxLineBytes+2)
 
 	for {
 		// Sliding read deadline (reset each iteration)
@@ -68,20 +104,17 @@ func (c *Client) readPump(hub *Hub, cfg *Config) {
 			return
 		}
 
-		if !scanner.Scan() {
-			if err := scanner.Err(); err != nil {
+		c.mu.Lock()
+		framer := c.framer
+		c.mu.Unlock()
+
+		msg, err := framer.ReadMessage(br)
+		if err != nil {
+			if err != io.EOF {
 				slog.Debug("client read error", "client", c.id, "err", err)
 			}
 			return
 		}
-
-		raw := scanner.Bytes()
-		if len(raw) > maxLineBytes {
-			slog.Warn("oversized line from client, disconnecting", "client", c.id, "len", len(raw))
-			return
-		}
-
-		msg := ParseLine(raw)
 		if msg == nil {
 			continue
 		}
@@ -94,76 +127,69 @@ func (c *Client) readPump(hub *Hub, cfg *Config) {
 	}
 }
 
-// writePump drains the send channel and writes to the TCP connection.
-// It exits when the hub closes the send channel (on client leave).
-func (c *Client) writePump() {
-	for msg := range c.send {
+// writePump drains the send queue and writes to the TCP connection.
+// It exits once the hub closes the queue (on client leave) and every
+// already-queued message has been written.
+func (c *Client) writePump(hub *Hub) {
+	for {
+		msg, ok := c.queue.pop()
+		if !ok {
+			return
+		}
 		if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
 			slog.Debug("setWriteDeadline failed", "client", c.id, "err", err)
-			// Drain remaining messages and exit
-			for range c.send {
-			}
 			return
 		}
-		if _, err := fmt.Fprint(c.conn, msg); err != nil {
+		if _, err := fmt.Fprint(c.conn, msg.framed); err != nil {
 			slog.Debug("write error", "client", c.id, "err", err)
-			// Drain remaining messages and exit
-			for range c.send {
-			}
+			hub.metrics.PacketsDroppedWriteTimeout++
 			return
 		}
 	}
 }
 
-// enqueue attempts to send a message to the client.
-// If the outbound buffer is full, the client connection is forcibly closed
-// (the readPump will detect the close and emit an EventLeave).
+// enqueue attempts to send a message to the client. msg is always
+// pre-formatted in line-protocol shape ("<prefix><content>\n") by the
+// caller; if the client has switched to a non-line Framer (see
+// onSwitchFramer), enqueue re-renders it through that framer instead of
+// writing the line-protocol bytes raw. Tags are lost in that re-render,
+// since nothing upstream of enqueue threads them through yet — see
+// framer.go's doc comment for why that's still a step forward.
+//
+// The message is then handed to c.queue, whose backpressure policy (see
+// sendqueue.go) may coalesce it with an already-queued one, drop it, or —
+// only as a last resort, mirroring the old fixed-channel behavior — force
+// the connection closed (the readPump will detect the close and emit an
+// EventLeave).
 func (c *Client) enqueue(msg string, hub *Hub) {
-	select {
-	case c.send <- msg:
-	default:
-		slog.Warn("client send buffer full, disconnecting", "client", c.id, "nick", c.nick)
-		c.conn.Close()
+	if len(msg) == 0 {
+		return
 	}
-}
 
-// consumeToken implements the token bucket rate limiter.
-// Returns true if a token was available (message allowed).
-// Must be called with c.mu held.
-func (c *Client) consumeToken(cfg *Config) bool {
-	now := time.Now()
-	elapsed := now.Sub(c.tokenLast).Seconds()
-	c.tokenLast = now
-	c.tokens += elapsed * cfg.Rate
-	if c.tokens > cfg.Burst {
-		c.tokens = cfg.Burst
-	}
-	if c.tokens >= 1.0 {
-		c.tokens--
-		return true
+	c.mu.Lock()
+	framer := c.framer
+	c.mu.Unlock()
+
+	prefix := msg[0]
+	content := strings.TrimSuffix(msg[1:], "\n")
+
+	framed := msg
+	if _, isLine := framer.(LineFramer); !isLine {
+		framed = framer.Format(prefix, content, nil)
 	}
-	return false
-}
 
-// scanLines is a bufio.SplitFunc that splits on '\n' and drops the terminator.
-// Lines longer than maxLineBytes are returned as-is (caller disconnects).
-func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	for i, b := range data {
-		if b == '\n' {
-			line := data[:i]
-			// Strip optional preceding \r
-			if len(line) > 0 && line[len(line)-1] == '\r' {
-				line = line[:len(line)-1]
-			}
-			return i + 1, line, nil
-		}
-		if i >= maxLineBytes {
-			// Line too long — return it so readPump can disconnect
-			return i + 1, data[:i], nil
-		}
+	qm := queuedMsg{prefix: prefix, priority: messagePriority(prefix), framed: framed}
+	if prefix == 'T' {
+		qm.nick, _, _ = splitFirstField(content)
 	}
-	if atEOF && len(data) > 0 {
-		return len(data), data, nil
+
+	switch outcome := c.queue.push(qm); {
+	case outcome.forceClose:
+		slog.Warn("client send queue full, disconnecting", "client", c.id, "nick", c.nick)
+		c.conn.Close()
+	case outcome.coalesced:
+		hub.metrics.PacketsDroppedCoalesced++
+	case outcome.droppedFull:
+		hub.metrics.PacketsDroppedQueueFull++
 	}
-	return 0, nil, nil
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+)
+
+// cloakSecretFile is where a CloakSecret is auto-generated and persisted
+// when cfg.CloakSecret is left empty. Unlike an unset StatsFile/BanFile
+// (which just means "don't persist"), a cloak secret has to stay stable
+// across restarts so a given IP always cloaks the same way.
+const cloakSecretFile = ".cloak-secret"
+
+// resolveCloakSecret returns cfg.CloakSecret if set, otherwise loads (or
+// creates) the secret at cloakSecretFile.
+func resolveCloakSecret(cfg *Config) (string, error) {
+	if cfg.CloakSecret != "" {
+		return cfg.CloakSecret, nil
+	}
+	if data, err := os.ReadFile(cloakSecretFile); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate cloak secret: %w", err)
+	}
+	hexSecret := hex.EncodeToString(secret)
+	if err := os.WriteFile(cloakSecretFile, []byte(hexSecret), 0600); err != nil {
+		slog.Warn("could not persist cloak secret, cloaks won't survive a restart", "err", err)
+	}
+	return hexSecret, nil
+}
+
+// CloakIP derives a stable, non-reversible per-IP token, styled like
+// goircd's -cloak option: an HMAC-SHA256 of ip keyed by secret, hex-encoded
+// and truncated to look host-like. IPv4 gets a single 8-hex-char label;
+// IPv6 gets two dash-separated 6-hex-char labels, for a bit more entropy
+// given the larger address space.
+func CloakIP(secret, ip string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ip))
+	sum := hex.EncodeToString(mac.Sum(nil))
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return sum[:6] + "-" + sum[6:12] + ".cloak"
+	}
+	return sum[:8] + ".cloak"
+}
+
+// cloakActive reports whether h can actually cloak (enabled and a secret
+// was resolved).
+func (h *Hub) cloakActive() bool {
+	return h.cfg.CloakEnabled && h.cloakSecret != ""
+}
+
+func (h *Hub) cloakIP(ip string) string {
+	return CloakIP(h.cloakSecret, ip)
+}
+
+// parseCloakTrustedViewers turns cfg.CloakTrustedViewers CIDR strings into
+// IPNets, the same way NewThrottler parses cfg.TrustedProxies; invalid
+// entries are logged and skipped rather than failing startup.
+func parseCloakTrustedViewers(cfg *Config) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range cfg.CloakTrustedViewers {
+		if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, ipnet)
+		} else {
+			slog.Warn("ignoring invalid cloak-trusted-viewers CIDR", "cidr", cidr, "err", err)
+		}
+	}
+	return nets
+}
+
+// isCloakTrustedViewer reports whether viewerIP is covered by
+// cfg.CloakTrustedViewers — a distinct allowlist from cfg.TrustedProxies,
+// which exists only to exempt a fronting reverse proxy from connection
+// throttling (see connlimit.go). Reusing TrustedProxies here would silently
+// disable cloaking for every ordinary player in any deployment that fronts
+// the chat listener with a TLS-terminating proxy, since every player's
+// Client.ip then equals the proxy's address, which is exactly what
+// TrustedProxies is configured with.
+func (h *Hub) isCloakTrustedViewer(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipnet := range h.cloakTrustedViewers {
+		if ipnet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayIP decides what IP string viewer should see for subjectIP, for
+// the chat protocol's in-band paths (onWhois, the 'J' join broadcast):
+// the real address if cloaking is off, viewer is in CloakTrustedViewers, or
+// viewer is an authenticated operator with CloakRevealForOps set —
+// otherwise the cloak. Ban matching in handleJoin always uses the real IP
+// directly and never goes through here.
+func (h *Hub) displayIP(viewer *Client, subjectIP string) string {
+	if !h.cloakActive() {
+		return subjectIP
+	}
+	if h.isCloakTrustedViewer(viewer.ip) {
+		return subjectIP
+	}
+	if h.cfg.CloakRevealForOps {
+		viewer.mu.Lock()
+		isOp := viewer.opName != ""
+		viewer.mu.Unlock()
+		if isOp {
+			return subjectIP
+		}
+	}
+	return h.cloakIP(subjectIP)
+}
+
+// publicIP is what buildSnapshot and dashboard SSE events show for
+// subjectIP. The public JSON/HTML endpoints have no caller identity to
+// weigh trust or operator status against, so they always get the cloak
+// when cloaking is active.
+func (h *Hub) publicIP(subjectIP string) string {
+	if !h.cloakActive() {
+		return subjectIP
+	}
+	return h.cloakIP(subjectIP)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Throttler guards RunTCPListener against a single host opening unbounded
+// TCP connections, complementing the per-client token bucket that only
+// applies once a connection is already inside the hub. It tracks, per key
+// (an IP, or its /64 prefix for IPv6 so a host can't dodge the limit by
+// rotating addresses within its allocated block):
+//
+//   - concurrent connection count, capped at MaxConcurrentPerIP
+//   - a sliding window of connect attempts, capped at ConnectRatePerIP per
+//     ConnectRateWindow
+//
+// A rate-based refusal blackholes the key for ThrottleCooldown so the
+// accept loop stops paying the TLS/handshake cost for repeat offenders.
+// Throttler has its own mutex (like sessionStore in adminweb.go) because
+// it's consulted from the TCP accept goroutine, outside the hub goroutine.
+type Throttler struct {
+	maxConcurrent int
+	rateLimit     int
+	rateWindow    time.Duration
+	cooldown      time.Duration
+	trusted       []*net.IPNet
+
+	mu         sync.Mutex
+	concurrent map[string]int
+	attempts   map[string][]time.Time
+	blackhole  map[string]time.Time
+
+	// refusedTotal is read cross-goroutine by buildSnapshot, so it's kept
+	// as a plain atomic counter rather than routed through Hub.metrics.
+	refusedTotal uint64
+}
+
+// NewThrottler builds a Throttler from cfg. Entries in cfg.TrustedProxies
+// that don't parse as CIDRs are logged and skipped.
+func NewThrottler(cfg *Config) *Throttler {
+	t := &Throttler{
+		maxConcurrent: cfg.MaxConcurrentPerIP,
+		rateLimit:     cfg.ConnectRatePerIP,
+		rateWindow:    time.Duration(cfg.ConnectRateWindow) * time.Second,
+		cooldown:      time.Duration(cfg.ThrottleCooldown) * time.Second,
+		concurrent:    make(map[string]int),
+		attempts:      make(map[string][]time.Time),
+		blackhole:     make(map[string]time.Time),
+	}
+	for _, cidr := range cfg.TrustedProxies {
+		if _, ipnet, err := net.ParseCIDR(cidr); err == nil {
+			t.trusted = append(t.trusted, ipnet)
+		} else {
+			slog.Warn("ignoring invalid trusted-proxies CIDR", "cidr", cidr, "err", err)
+		}
+	}
+	return t
+}
+
+func (t *Throttler) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipnet := range t.trusted {
+		if ipnet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// throttleKey maps ip to the bucket it's throttled under: the address
+// itself for IPv4, or its /64 prefix for IPv6.
+func throttleKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.String()
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// Allow reports whether a new connection from ip should be accepted. When
+// refused, reason is "concurrency" or "rate" (the latter also blackholes
+// the key for t.cooldown, so repeat offenders are rejected without
+// re-evaluating the sliding window on every attempt).
+func (t *Throttler) Allow(ip string) (ok bool, reason string) {
+	if t.isTrusted(ip) || (t.maxConcurrent <= 0 && t.rateLimit <= 0) {
+		return true, ""
+	}
+
+	key := throttleKey(ip)
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until, blackholed := t.blackhole[key]; blackholed {
+		if now.Before(until) {
+			atomic.AddUint64(&t.refusedTotal, 1)
+			return false, "rate"
+		}
+		delete(t.blackhole, key)
+	}
+
+	if t.maxConcurrent > 0 && t.concurrent[key] >= t.maxConcurrent {
+		atomic.AddUint64(&t.refusedTotal, 1)
+		return false, "concurrency"
+	}
+
+	if t.rateLimit > 0 {
+		cutoff := now.Add(-t.rateWindow)
+		kept := t.attempts[key][:0]
+		for _, at := range t.attempts[key] {
+			if at.After(cutoff) {
+				kept = append(kept, at)
+			}
+		}
+		if len(kept) >= t.rateLimit {
+			t.blackhole[key] = now.Add(t.cooldown)
+			t.attempts[key] = kept
+			atomic.AddUint64(&t.refusedTotal, 1)
+			return false, "rate"
+		}
+		t.attempts[key] = append(kept, now)
+	}
+
+	t.concurrent[key]++
+	return true, ""
+}
+
+// Release decrements ip's concurrent connection count. Call once per
+// connection accepted by Allow, when that connection closes.
+func (t *Throttler) Release(ip string) {
+	key := throttleKey(ip)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.concurrent[key] > 0 {
+		t.concurrent[key]--
+		if t.concurrent[key] == 0 {
+			delete(t.concurrent, key)
+		}
+	}
+}
+
+// Blackhole blacklists ip for d, the same mechanism a tripped connect-rate
+// limit uses. Used by the rate-limit policy (see ratelimit.go) to record a
+// cooldown for a client kicked for flooding once it's already inside the
+// hub, so it can't immediately reconnect and start over.
+func (t *Throttler) Blackhole(ip string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	key := throttleKey(ip)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.blackhole[key] = time.Now().Add(d)
+}
+
+// Snapshot returns the current blackholed-IP count and the running total of
+// refused connections, for StatusSnapshot/MetricsInfo.
+func (t *Throttler) Snapshot() (blackholedIPs int, refusedTotal int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for key, until := range t.blackhole {
+		if now.After(until) {
+			delete(t.blackhole, key)
+		}
+	}
+	return len(t.blackhole), int64(atomic.LoadUint64(&t.refusedTotal))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// maxFrameBytes bounds a single LengthPrefixFramer payload, mirroring the
+// line protocol's maxLineBytes cap in client.go.
+const maxFrameBytes = 8192
+
+// errOversizedLine is returned by a Framer's ReadMessage when a single
+// inbound message exceeds the framer's size limit; readPump treats it like
+// any other read error and disconnects.
+var errOversizedLine = errors.New("client message too large")
+
+// Framer turns a server-side (prefix, content, tags) message into the bytes
+// written to a client's connection, and turns bytes read from that
+// connection back into a ClientMessage. Every client starts out speaking
+// LineFramer, the original bare "<prefix><content>\n" protocol, and may
+// switch to LengthPrefixFramer via the 'X' command (see onSwitchFramer).
+type Framer interface {
+	// Format renders one outbound message. tags may be nil.
+	Format(prefix byte, content string, tags map[string]string) string
+	// ReadMessage reads and parses the next inbound message from br. A nil
+	// *ClientMessage with a nil error means "skip, read the next one",
+	// matching ParseLine's existing empty-line contract.
+	ReadMessage(br *bufio.Reader) (*ClientMessage, error)
+}
+
+// LineFramer is today's line protocol. Format just wraps FormatMsg, and
+// ReadMessage is scanLines' old splitting logic restated as a Framer method,
+// so the hub can go through c.framer without caring whether a given client
+// ever switches away from it.
+type LineFramer struct{}
+
+func (LineFramer) Format(prefix byte, content string, _ map[string]string) string {
+	return FormatMsg(prefix, content)
+}
+
+func (LineFramer) ReadMessage(br *bufio.Reader) (*ClientMessage, error) {
+	raw, err := br.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, errOversizedLine
+		}
+		return nil, err
+	}
+	line := raw[:len(raw)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return ParseLine(line), nil
+}
+
+// framedEnvelope is the wire shape LengthPrefixFramer exchanges: a flat,
+// JSON-friendly stand-in for what would otherwise be a generated protobuf
+// message. Tags and Timestamp give IRCv3-style message-tag room (server
+// time, ack ids, typed events) without the line protocol's clients ever
+// seeing a format change.
+type framedEnvelope struct {
+	Prefix    byte              `json:"prefix"`
+	Content   string            `json:"content"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+}
+
+// LengthPrefixFramer carries framedEnvelope values behind a uvarint length
+// prefix, negotiated per-connection via the 'X' command. JSON rather than
+// protobuf purely for lack of a vendored codegen toolchain in this repo;
+// the envelope is kept flat enough that swapping the encoding later
+// wouldn't touch anything outside this type.
+type LengthPrefixFramer struct{}
+
+func (LengthPrefixFramer) Format(prefix byte, content string, tags map[string]string) string {
+	env := framedEnvelope{Prefix: prefix, Content: content, Tags: tags, Timestamp: time.Now().Unix()}
+	payload, err := json.Marshal(env)
+	if err != nil {
+		payload = []byte("{}")
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(payload)))
+	return string(lenBuf[:n]) + string(payload)
+}
+
+func (LengthPrefixFramer) ReadMessage(br *bufio.Reader) (*ClientMessage, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxFrameBytes {
+		return nil, errOversizedLine
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+	var env framedEnvelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		// Malformed frame: the announced byte count was still consumed
+		// above, so the stream stays in sync — just skip it.
+		return nil, nil
+	}
+	return &ClientMessage{Prefix: env.Prefix, Content: env.Content, Tags: env.Tags, Timestamp: env.Timestamp}, nil
+}
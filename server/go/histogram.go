@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// histogramBuckets are the cumulative upper bounds (in seconds) for
+// mortalnet_message_latency_seconds.
+var histogramBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Histogram is a cumulative-bucket histogram with lock-free observation:
+// Observe is a handful of atomic.AddUint64 calls, safe to call from the
+// hub's hot path without contending with the HTTP goroutine that reads it
+// for /metrics.
+type Histogram struct {
+	buckets [8]uint64 // counts, index-aligned with histogramBuckets
+	count   uint64
+	sumBits uint64 // math.Float64bits of the running sum, updated via CAS
+}
+
+// Observe records one sample. Bucket counts are cumulative, matching the
+// OpenMetrics/Prometheus histogram convention: a bucket's count includes
+// every observation less than or equal to its upper bound.
+func (hg *Histogram) Observe(seconds float64) {
+	for i, upper := range histogramBuckets {
+		if seconds <= upper {
+			atomic.AddUint64(&hg.buckets[i], 1)
+		}
+	}
+	atomic.AddUint64(&hg.count, 1)
+	for {
+		old := atomic.LoadUint64(&hg.sumBits)
+		sum := math.Float64frombits(old) + seconds
+		if atomic.CompareAndSwapUint64(&hg.sumBits, old, math.Float64bits(sum)) {
+			return
+		}
+	}
+}
+
+// HistogramSnapshot is a point-in-time read of a Histogram's state.
+type HistogramSnapshot struct {
+	Buckets []uint64 // cumulative counts, index-aligned with histogramBuckets
+	Count   uint64
+	Sum     float64
+}
+
+func (hg *Histogram) Snapshot() HistogramSnapshot {
+	buckets := make([]uint64, len(histogramBuckets))
+	for i := range buckets {
+		buckets[i] = atomic.LoadUint64(&hg.buckets[i])
+	}
+	return HistogramSnapshot{
+		Buckets: buckets,
+		Count:   atomic.LoadUint64(&hg.count),
+		Sum:     math.Float64frombits(atomic.LoadUint64(&hg.sumBits)),
+	}
+}
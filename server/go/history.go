@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// historyBucket is the single bbolt bucket chat history records live in,
+// keyed by an 8-byte big-endian monotonic sequence number so cursor order
+// matches insertion order — the same seek-by-key replay strategy Oragono's
+// history package uses against its own KV store.
+var historyBucket = []byte("history")
+
+// HistoryRecord is one persisted chat line. Room is "" for the lobby
+// broadcast (onMessage) and a room name for room messages (onRoomMessage).
+type HistoryRecord struct {
+	Seq  uint64    `json:"seq"`
+	TS   time.Time `json:"ts"`
+	Nick string    `json:"nick"`
+	Text string    `json:"text"`
+	Room string    `json:"room"`
+}
+
+// historyWriteBufSize bounds HistoryStore.writes; a full buffer means the
+// store's background goroutine is behind, so the write is dropped rather
+// than blocking the hub goroutine that calls Append.
+const historyWriteBufSize = 256
+
+// historySweepInterval is how often HistoryStore.run expires records past
+// cfg.HistoryRetentionHours.
+const historySweepInterval = 10 * time.Minute
+
+// HistoryStore is a durable, seekable chat history backed by bbolt. All
+// bbolt access happens on the goroutine started by run; Append only ever
+// enqueues onto a buffered channel, so the hub goroutine never blocks on
+// disk I/O. Replay* methods are called directly from the hub goroutine —
+// safe because bbolt serves reads concurrently with the single writer.
+type HistoryStore struct {
+	db        *bbolt.DB
+	writes    chan HistoryRecord
+	retention time.Duration
+}
+
+// OpenHistoryStore opens (creating if necessary) the bbolt file at
+// cfg.HistoryFile and prepares its history bucket.
+func OpenHistoryStore(cfg *Config) (*HistoryStore, error) {
+	db, err := bbolt.Open(cfg.HistoryFile, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open history store: %w", err)
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init history bucket: %w", err)
+	}
+	return &HistoryStore{
+		db:        db,
+		writes:    make(chan HistoryRecord, historyWriteBufSize),
+		retention: time.Duration(cfg.HistoryRetentionHours) * time.Hour,
+	}, nil
+}
+
+// run drains writes and sweeps expired records until ctx is cancelled, then
+// flushes any buffered writes and closes the database. Started from
+// Hub.Run so its lifetime matches the hub goroutine's.
+func (hs *HistoryStore) run(ctx context.Context) {
+	ticker := time.NewTicker(historySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			hs.drainAndClose()
+			return
+		case rec := <-hs.writes:
+			hs.write(rec)
+		case <-ticker.C:
+			hs.sweep()
+		}
+	}
+}
+
+func (hs *HistoryStore) drainAndClose() {
+	for {
+		select {
+		case rec := <-hs.writes:
+			hs.write(rec)
+		default:
+			if err := hs.db.Close(); err != nil {
+				slog.Warn("error closing history store", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// Append enqueues rec for persistence. Non-blocking: if the write buffer is
+// full, the record is dropped and logged rather than stalling the caller.
+func (hs *HistoryStore) Append(rec HistoryRecord) {
+	select {
+	case hs.writes <- rec:
+	default:
+		slog.Warn("history write buffer full, dropping record", "nick", rec.Nick, "room", rec.Room)
+	}
+}
+
+func (hs *HistoryStore) write(rec HistoryRecord) {
+	err := hs.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		rec.Seq = seq
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return b.Put(seqKey(seq), data)
+	})
+	if err != nil {
+		slog.Warn("history write failed", "err", err)
+	}
+}
+
+// sweep deletes records older than cfg.HistoryRetentionHours. Keys are in
+// insertion (and therefore chronological) order, so the first non-expired
+// key ends the scan.
+func (hs *HistoryStore) sweep() {
+	if hs.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-hs.retention)
+	var expired [][]byte
+	hs.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var rec HistoryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				continue
+			}
+			if rec.TS.After(cutoff) {
+				break
+			}
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if len(expired) == 0 {
+		return
+	}
+	err := hs.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("history sweep delete failed", "err", err)
+		return
+	}
+	slog.Info("history sweep expired records", "count", len(expired))
+}
+
+// ReplayLast returns up to n of room's most recent messages (room=="" for
+// the lobby), oldest first, for replay to a newly joined client.
+func (hs *HistoryStore) ReplayLast(room string, n int) []HistoryRecord {
+	if n <= 0 {
+		return nil
+	}
+	var out []HistoryRecord
+	hs.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(out) < n; k, v = c.Prev() {
+			var rec HistoryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				continue
+			}
+			if rec.Room != room {
+				continue
+			}
+			out = append(out, rec)
+		}
+		return nil
+	})
+	reverseHistory(out)
+	return out
+}
+
+// ReplaySince returns up to maxRecords of the most recent records (any
+// room) newer than now-seconds, oldest first, for the "H<seconds>"
+// protocol command. Like ReplayLast/ReplayForNick, the cursor walk itself
+// stops once maxRecords is reached rather than collecting every surviving
+// record back to the cutoff and truncating afterward — a client sending
+// H<seconds> with a very large seconds on a long-lived, high-retention
+// server would otherwise make this walk the whole bucket back toward
+// genesis for one unauthenticated line.
+func (hs *HistoryStore) ReplaySince(seconds, maxRecords int) []HistoryRecord {
+	cutoff := time.Now().Add(-time.Duration(seconds) * time.Second)
+	var out []HistoryRecord
+	hs.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Last(); k != nil && (maxRecords <= 0 || len(out) < maxRecords); k, v = c.Prev() {
+			var rec HistoryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				continue
+			}
+			if rec.TS.Before(cutoff) {
+				break
+			}
+			out = append(out, rec)
+		}
+		return nil
+	})
+	reverseHistory(out)
+	return out
+}
+
+// historyMaxNickScan bounds how many records ReplayForNick examines per
+// call, separate from count (how many matching records it returns). A nick
+// that never posted, or posted only rarely, would otherwise make the
+// cursor walk the entire bucket looking for matches that aren't there —
+// the same unbounded-walk problem ReplaySince was patched for in 26ef79f
+// — and H@<nick> is reachable by any just-confirmed client.
+const historyMaxNickScan = 5000
+
+// ReplayForNick returns up to count of nick's most recent messages (any
+// room, among the most recent historyMaxNickScan records), oldest first,
+// for the whois-style "H@nick <count>" backscroll command.
+func (hs *HistoryStore) ReplayForNick(nick string, count int) []HistoryRecord {
+	if count <= 0 {
+		return nil
+	}
+	var out []HistoryRecord
+	hs.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		scanned := 0
+		for k, v := c.Last(); k != nil && len(out) < count && scanned < historyMaxNickScan; k, v = c.Prev() {
+			scanned++
+			var rec HistoryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				continue
+			}
+			if rec.Nick == nick {
+				out = append(out, rec)
+			}
+		}
+		return nil
+	})
+	reverseHistory(out)
+	return out
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func reverseHistory(recs []HistoryRecord) {
+	for i, j := 0, len(recs)-1; i < j; i, j = i+1, j-1 {
+		recs[i], recs[j] = recs[j], recs[i]
+	}
+}
+
+// formatHistoryRecord renders rec as the same wire line a live message
+// would have produced, so replayed history needs no client-side special
+// casing.
+func formatHistoryRecord(rec HistoryRecord) string {
+	if rec.Room == "" {
+		return FormatMsg('M', rec.Nick+" "+rec.Text)
+	}
+	return FormatMsg('O', rec.Room+" "+rec.Nick+" "+rec.Text)
+}
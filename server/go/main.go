@@ -7,10 +7,18 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 )
 
+// buildVersion and buildCommit are overridden at build time via
+// -ldflags "-X main.buildVersion=... -X main.buildCommit=...".
+var (
+	buildVersion = "dev"
+	buildCommit  = "unknown"
+)
+
 // Config holds all runtime configuration.
 type Config struct {
 	// Network
@@ -31,15 +39,64 @@ type Config struct {
 	HistorySize int
 	// Nick reservation
 	NickReserveSecs int
+	// Nick validation: "ascii" (default, [a-zA-Z0-9_-]) or "unicode"
+	// (NFKC-normalized, casefolded, single-script; see nickpolicy.go)
+	NickPolicy string
 	// Persistent stats
 	StatsFile string
-	// Admin
+	// Admin (web console login; see adminweb.go)
 	AdminPassword string
+	// Operator accounts for the chat protocol's 'A'/'E' admin commands
+	// (see operators.go). Unrelated to AdminPassword above.
+	OperatorsFile string
 	// Ban list
 	BanFile string
 	// TLS
 	TLSCert string
 	TLSKey  string
+	// ACME / Let's Encrypt (overrides TLSCert/TLSKey when set)
+	ACMEDomains  []string
+	ACMECacheDir string
+	// statsd/DogStatsD metrics
+	StatsdAddr          string
+	StatsdPrefix        string
+	StatsdFlushInterval int
+	// Per-IP connection throttling (see connlimit.go)
+	MaxConcurrentPerIP int
+	ConnectRatePerIP   int
+	ConnectRateWindow  int
+	ThrottleCooldown   int
+	TrustedProxies     []string
+	// Persistent chat history (see history.go)
+	HistoryFile           string
+	HistoryRetentionHours int
+	HistoryMaxReplay      int
+	// IP cloaking for whois/join/dashboard output (see cloak.go)
+	CloakEnabled      bool
+	CloakSecret       string
+	CloakRevealForOps bool
+	// CloakTrustedViewers is a distinct allowlist from TrustedProxies
+	// (which only exempts a fronting reverse proxy from connection
+	// throttling): viewers in these CIDRs see real IPs through the cloak
+	// even without operator status. See isCloakTrustedViewer in cloak.go.
+	CloakTrustedViewers []string
+	// Multiline batch protocol (see onBatch in server.go)
+	MaxBatchLines int
+	MaxBatchBytes int
+	// Pluggable rate-limit policy (see ratelimit.go). RateWeights is parsed
+	// from the rate-weights flag by parseConfig.
+	RateWeights          map[byte]float64
+	RateWarnStrikes      int
+	RateMuteStrikes      int
+	RateMuteSeconds      int
+	RateKickCooldownSecs int
+	// Per-client outbound backpressure (see sendqueue.go). A lagging client
+	// (queue length >= SendQueueHighWater) stops receiving low-priority
+	// traffic (chat) until it drains back down to SendQueueLowWater,
+	// instead of being disconnected outright.
+	SendQueueSize      int
+	SendQueueHighWater int
+	SendQueueLowWater  int
 }
 
 func parseConfig() *Config {
@@ -56,12 +113,61 @@ func parseConfig() *Config {
 	flag.StringVar(&cfg.MOTDFile,        "motd-file",          "",        "Path to MOTD file (reloaded on SIGHUP)")
 	flag.IntVar(&cfg.HistorySize,        "history-size",       20,        "Chat lines replayed to new joiners")
 	flag.IntVar(&cfg.NickReserveSecs,    "nick-reserve-secs",  60,        "Seconds a nick is reserved after disconnect")
+	flag.StringVar(&cfg.NickPolicy,      "nick-policy",        "ascii",   "Nick validation: ascii or unicode (NFKC + confusable/homoglyph defense)")
 	flag.StringVar(&cfg.StatsFile,       "stats-file",         "",        "Path to JSON stats file ('' = disabled)")
-	flag.StringVar(&cfg.AdminPassword,   "admin-password",     "",        "Admin password ('' = admin disabled)")
-	flag.StringVar(&cfg.BanFile,         "ban-file",           "",        "Path to IP ban list (one IP per line)")
+	flag.StringVar(&cfg.AdminPassword,   "admin-password",     "",        "Web admin console password ('' = admin console disabled)")
+	flag.StringVar(&cfg.OperatorsFile,   "operators-file",     "",        "Path to JSON operator account store (bcrypt password hashes; '' = chat admin commands disabled)")
+	flag.StringVar(&cfg.BanFile,         "ban-file",           "",        "Path to the ban store (JSON, atomic-rename on save; '' = disabled)")
 	flag.StringVar(&cfg.TLSCert,         "tls-cert",           "",        "Path to TLS certificate file")
 	flag.StringVar(&cfg.TLSKey,          "tls-key",            "",        "Path to TLS private key file")
+	var acmeDomains string
+	flag.StringVar(&acmeDomains,         "acme-domains",       "",        "Comma-separated domains for ACME/Let's Encrypt (overrides tls-cert/tls-key)")
+	flag.StringVar(&cfg.ACMECacheDir,    "acme-cache-dir",     "acme-cache", "Directory for cached ACME certificates")
+	flag.StringVar(&cfg.StatsdAddr,      "statsd-addr",        "",        "statsd/DogStatsD UDP endpoint ('' = disabled)")
+	flag.StringVar(&cfg.StatsdPrefix,    "statsd-prefix",      "mortalnet", "Prefix applied to every statsd metric name")
+	flag.IntVar(&cfg.StatsdFlushInterval,"statsd-flush-secs",  10,        "Seconds between statsd gauge flushes")
+	flag.IntVar(&cfg.MaxConcurrentPerIP, "max-concurrent-per-ip", 0,      "Concurrent chat connections allowed per IP (0 = unlimited)")
+	flag.IntVar(&cfg.ConnectRatePerIP,   "connect-rate-per-ip", 0,        "Connection attempts allowed per IP per connect-rate-window (0 = unlimited)")
+	flag.IntVar(&cfg.ConnectRateWindow,  "connect-rate-window",  60,      "Sliding window, in seconds, for connect-rate-per-ip")
+	flag.IntVar(&cfg.ThrottleCooldown,   "throttle-cooldown",    300,     "Seconds an IP is blackholed after tripping the connect rate limit")
+	var trustedProxies string
+	flag.StringVar(&trustedProxies,      "trusted-proxies",    "",        "Comma-separated CIDRs exempt from connection throttling")
+	flag.StringVar(&cfg.HistoryFile,           "history-file",            "",  "Path to the bbolt chat history store ('' = disabled)")
+	flag.IntVar(&cfg.HistoryRetentionHours,    "history-retention-hours", 168, "Hours to retain chat history records (0 = forever)")
+	flag.IntVar(&cfg.HistoryMaxReplay,         "history-max-replay",      50,  "Maximum history records replayed for join/H<seconds>/H@nick")
+	flag.BoolVar(&cfg.CloakEnabled,            "cloak-enabled",           false, "Cloak client IPs in whois/join/dashboard output")
+	flag.StringVar(&cfg.CloakSecret,           "cloak-secret",            "",  "HMAC key for IP cloaking ('' = auto-generate to .cloak-secret)")
+	flag.BoolVar(&cfg.CloakRevealForOps,       "cloak-reveal-for-ops",    true, "Authenticated operators see real IPs instead of cloaks")
+	var cloakTrustedViewers string
+	flag.StringVar(&cloakTrustedViewers,       "cloak-trusted-viewers",   "",  "Comma-separated CIDRs that see real IPs through the cloak (distinct from trusted-proxies)")
+	flag.IntVar(&cfg.MaxBatchLines,            "max-batch-lines",         50,  "Maximum lines in one Bstart/Bend multiline batch")
+	flag.IntVar(&cfg.MaxBatchBytes,            "max-batch-bytes",         8192, "Maximum total bytes in one Bstart/Bend multiline batch")
+	var rateWeights string
+	flag.StringVar(&rateWeights,                "rate-weights",           "M=1,T=0.2,J=5,E=10,R=1,P=0.5,K=1,H=5,N=2", "Comma-separated prefix=weight token costs (e.g. M=1,T=0.2,J=5)")
+	flag.IntVar(&cfg.RateWarnStrikes,           "rate-warn-strikes",       3,    "Strikes over budget before the client is muted instead of just warned")
+	flag.IntVar(&cfg.RateMuteStrikes,           "rate-mute-strikes",       8,    "Strikes over budget before the client is disconnected instead of muted")
+	flag.IntVar(&cfg.RateMuteSeconds,           "rate-mute-seconds",       30,   "Seconds a muted client's traffic is silently dropped")
+	flag.IntVar(&cfg.RateKickCooldownSecs,      "rate-kick-cooldown-secs", 300,  "Seconds an IP is blackholed after a rate-limit disconnect")
+	flag.IntVar(&cfg.SendQueueSize,             "send-queue-size",         256,  "Capacity of a client's outbound send queue")
+	flag.IntVar(&cfg.SendQueueHighWater,        "send-queue-high-water",   192,  "Queue length at which a client is considered lagging and stops receiving low-priority (chat) traffic")
+	flag.IntVar(&cfg.SendQueueLowWater,         "send-queue-low-water",    64,   "Queue length a lagging client must drain back to before low-priority traffic resumes")
 	flag.Parse()
+	for _, d := range strings.Split(acmeDomains, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			cfg.ACMEDomains = append(cfg.ACMEDomains, d)
+		}
+	}
+	for _, p := range strings.Split(trustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, p)
+		}
+	}
+	for _, p := range strings.Split(cloakTrustedViewers, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.CloakTrustedViewers = append(cfg.CloakTrustedViewers, p)
+		}
+	}
+	cfg.RateWeights = parseRateWeights(rateWeights)
 	return cfg
 }
 
@@ -91,7 +197,8 @@ func main() {
 		"chat", cfg.ChatAddr,
 		"web",  cfg.WebAddr,
 		"maxClients", cfg.MaxClients,
-		"tls", cfg.TLSCert != "",
+		"tls", cfg.TLSCert != "" || len(cfg.ACMEDomains) > 0,
+		"statsd", cfg.StatsdAddr != "",
 	)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -117,7 +224,9 @@ func main() {
 			switch sig {
 			case syscall.SIGHUP:
 				slog.Info("SIGHUP received, reloading")
+				sdNotify("RELOADING=1")
 				hub.events <- HubEvent{Type: EventSIGHUP}
+				sdNotify("READY=1")
 			default:
 				slog.Info("signal received, shutting down", "signal", sig)
 				cancel()
@@ -126,18 +235,53 @@ func main() {
 		}
 	}()
 
+	// TLS config (static cert w/ SIGHUP reload, or ACME) shared by the chat
+	// and dashboard listeners. Both come back nil when TLS isn't configured.
+	tlsConfig, acmeHandler, err := buildTLSConfig(ctx, cfg, hub)
+	if err != nil {
+		slog.Error("failed to set up TLS", "err", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// TCP listener
-	if err := RunTCPListener(ctx, cfg, hub, &wg); err != nil {
+	if err := RunTCPListener(ctx, cfg, hub, &wg, tlsConfig); err != nil {
 		slog.Error("failed to start TCP listener", "err", err)
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	// systemd watchdog keepalive (no-op unless $WATCHDOG_USEC is set)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runWatchdog(ctx, hub)
+	}()
+
+	// RunWebServer below binds its listener synchronously before blocking,
+	// so by this point both the chat and dashboard listeners are up: tell
+	// systemd we're ready (no-op unless $NOTIFY_SOCKET is set).
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Debug("sd_notify ready failed", "err", err)
+	}
+
+	// statsd/DogStatsD metrics emitter (optional)
+	if cfg.StatsdAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := RunStatsdEmitter(ctx, cfg, hub); err != nil {
+				slog.Error("statsd emitter error", "err", err)
+			}
+		}()
+	}
+
 	// Web server (blocks until ctx cancelled, then shuts down gracefully)
-	if err := RunWebServer(ctx, cfg, hub); err != nil {
+	if err := RunWebServer(ctx, cfg, hub, tlsConfig, acmeHandler); err != nil {
 		slog.Error("web server error", "err", err)
 	}
 
 	wg.Wait()
+	sdNotify("STOPPING=1")
 	slog.Info("MortalNet server stopped.")
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusableScripts are the scripts checked for mixing (see hasMixedScript)
+// and the scripts runeScript recognizes at all; runes outside them (digits,
+// '_'/'-', anything else allowed by allowedNickRune) are script-neutral.
+var confusableScripts = []string{"Latin", "Cyrillic", "Greek"}
+
+func runeScript(r rune) string {
+	for _, name := range confusableScripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// hasMixedScript reports whether s contains runes from more than one of
+// confusableScripts — e.g. Cyrillic 'а' (U+0430) alongside Latin 'a'.
+func hasMixedScript(s string) bool {
+	seen := ""
+	for _, r := range s {
+		script := runeScript(r)
+		if script == "" {
+			continue
+		}
+		if seen == "" {
+			seen = script
+		} else if seen != script {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedNickRune is the Unicode-mode character whitelist: identifier-like
+// categories (L = letters, Nd = decimal digits, Mn = nonspacing marks,
+// for combining accents) plus the same '_'/'-' the ASCII mode allows.
+func allowedNickRune(r rune) bool {
+	return r == '_' || r == '-' ||
+		unicode.Is(unicode.L, r) || unicode.Is(unicode.Nd, r) || unicode.Is(unicode.Mn, r)
+}
+
+// ValidateUnicodeNick reports whether nick is already in Unicode-mode
+// canonical form: 1-20 runes, every rune in allowedNickRune, and no script
+// mixing. SanitizeUnicodeNick's output always satisfies this.
+func ValidateUnicodeNick(nick string) bool {
+	runeCount := 0
+	if hasMixedScript(nick) {
+		return false
+	}
+	for _, r := range nick {
+		runeCount++
+		if runeCount > 20 || !allowedNickRune(r) {
+			return false
+		}
+	}
+	return runeCount > 0
+}
+
+// SanitizeUnicodeNick is the Unicode-mode counterpart to SanitizeNick: it
+// NFKC-normalizes and casefolds nick, keeps only identifier-like runes (see
+// allowedNickRune), drops runes that would mix it with a second script (see
+// hasMixedScript), and truncates to 20 runes. Falls back to "Player" if
+// nothing survives, same as the ASCII variant.
+func SanitizeUnicodeNick(nick string) string {
+	folded := strings.Map(unicode.ToLower, norm.NFKC.String(nick))
+
+	var b strings.Builder
+	runeCount := 0
+	firstScript := ""
+	for _, r := range folded {
+		if !allowedNickRune(r) {
+			continue
+		}
+		if script := runeScript(r); script != "" {
+			if firstScript == "" {
+				firstScript = script
+			} else if script != firstScript {
+				continue
+			}
+		}
+		b.WriteRune(r)
+		runeCount++
+		if runeCount == 20 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "Player"
+	}
+	return b.String()
+}
+
+// confusables maps casefolded runes from other scripts to the Latin letter
+// they're most often mistaken for — a small, hand-picked subset of Unicode
+// TR39's confusables table covering the Cyrillic and Greek letters that
+// look closest to Latin ones.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'х': 'x',
+	'у': 'y', 'і': 'i', 'ѕ': 's', 'ј': 'j', 'к': 'k', 'м': 'm',
+	'н': 'h', 'т': 't', 'в': 'b',
+	// Greek
+	'α': 'a', 'ο': 'o', 'ρ': 'p', 'υ': 'y', 'κ': 'k', 'χ': 'x',
+	'ι': 'i', 'ν': 'v', 'τ': 't', 'β': 'b',
+}
+
+// NickSkeleton reduces nick to the canonical form the hub-wide
+// Hub.nickSkeletons registry keys on: NFKC-normalized, casefolded, and with
+// every confusable rune mapped to its Latin look-alike. Two nicks that
+// produce the same skeleton are visually indistinguishable and must not
+// both be in use at once.
+func NickSkeleton(nick string) string {
+	folded := strings.Map(unicode.ToLower, norm.NFKC.String(nick))
+	var b strings.Builder
+	for _, r := range folded {
+		if mapped, ok := confusables[r]; ok {
+			r = mapped
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
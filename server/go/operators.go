@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Operator privileges gate individual 'A' admin subcommands; see
+// adminCommandPrivilege. An operator with no matching privilege for a
+// command is refused even once authenticated via 'E'.
+const (
+	PrivKick    = "kick"
+	PrivBan     = "ban"
+	PrivMOTD    = "motd"
+	PrivReload  = "reload"
+	PrivWallops = "wallops"
+	PrivRooms   = "rooms"
+)
+
+// OperatorAccount is one entry in the operators file. PasswordHash is a
+// bcrypt hash (golang.org/x/crypto/bcrypt), matching how Oragono/Ergo store
+// operator credentials — never the plaintext password itself.
+type OperatorAccount struct {
+	PasswordHash string   `json:"password_hash"`
+	Privileges   []string `json:"privileges"`
+}
+
+// has reports whether the account carries priv.
+func (o OperatorAccount) has(priv string) bool {
+	for _, p := range o.Privileges {
+		if p == priv {
+			return true
+		}
+	}
+	return false
+}
+
+// loadOperators reads the JSON operator account store. Missing or
+// unparsable files just leave the in-memory operator set empty, same as a
+// missing ban or stats file.
+func (h *Hub) loadOperators() {
+	h.operators = make(map[string]OperatorAccount)
+	if h.cfg.OperatorsFile == "" {
+		return
+	}
+	f, err := os.Open(h.cfg.OperatorsFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var accounts map[string]OperatorAccount
+	if err := json.NewDecoder(f).Decode(&accounts); err != nil {
+		slog.Warn("could not parse operators file", "err", err)
+		return
+	}
+	h.operators = accounts
+	slog.Info("loaded operator accounts", "count", len(accounts))
+}
+
+// operatorAuthResult carries the outcome of a beginOperatorAuth comparison
+// back to the hub goroutine as an EventOperatorAuthResult.
+type operatorAuthResult struct {
+	nick string
+	name string
+	ok   bool
+}
+
+// beginOperatorAuth looks up the named account on the hub goroutine (a plain
+// map read, safe here since h.operators is only ever mutated by the hub
+// goroutine itself via loadOperators) and hands the slow bcrypt comparison
+// off to its own goroutine, which reports back through h.events instead of
+// blocking the hub on CompareHashAndPassword.
+func (h *Hub) beginOperatorAuth(c *Client, nick, name, password string) {
+	acct, exists := h.operators[name]
+	go func() {
+		ok := exists && bcrypt.CompareHashAndPassword([]byte(acct.PasswordHash), []byte(password)) == nil
+		h.events <- HubEvent{
+			Type:   EventOperatorAuthResult,
+			Client: c,
+			OpAuth: &operatorAuthResult{nick: nick, name: name, ok: ok},
+		}
+	}()
+}
+
+// adminCommandPrivilege returns the privilege an 'A' subcommand requires.
+// needed is false for commands any authenticated operator may run.
+func adminCommandPrivilege(cmd string) (priv string, needed bool) {
+	switch cmd {
+	case "kick":
+		return PrivKick, true
+	case "ban", "unban", "bans", "howtoban":
+		return PrivBan, true
+	case "reload":
+		return PrivReload, true
+	case "motd":
+		return PrivMOTD, true
+	case "mkroom", "rmroom", "topic":
+		return PrivRooms, true
+	case "wallops":
+		return PrivWallops, true
+	default:
+		return "", false
+	}
+}
@@ -14,6 +14,14 @@ func ValidateNick(nick string) bool {
 	return nickRe.MatchString(nick)
 }
 
+// roomNameRe is the whitelist for valid room names.
+var roomNameRe = regexp.MustCompile(`^[a-zA-Z0-9_\-]{1,32}$`)
+
+// ValidateRoomName returns true if name matches the room name whitelist.
+func ValidateRoomName(name string) bool {
+	return roomNameRe.MatchString(name)
+}
+
 // SanitizeNick strips any characters not in the whitelist and truncates to 20.
 // Falls back to "Player" if the result is empty.
 func SanitizeNick(nick string) string {
@@ -52,10 +60,14 @@ func ValidStatus(s string) bool {
 	return false
 }
 
-// ClientMessage is a parsed message from a client.
+// ClientMessage is a parsed message from a client. Tags and Timestamp are
+// only ever populated for a client that negotiated the structured framing
+// (see framer.go); line-protocol clients leave them nil/zero.
 type ClientMessage struct {
-	Prefix  byte
-	Content string
+	Prefix    byte
+	Content   string
+	Tags      map[string]string
+	Timestamp int64
 }
 
 // ParseLine parses a raw line (without trailing newline) from the client.
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Room is a topic-specific chat channel layered on top of the lobby-wide
+// broadcast that onMessage still uses for backwards compatibility. Like the
+// rest of Hub's state, membership and history are only ever touched from
+// the hub goroutine.
+type Room struct {
+	name      string
+	topic     string
+	members   map[uint64]*Client
+	history   []string // ring buffer, capped at cfg.HistorySize, for instant join replay
+	createdAt time.Time
+	modes     RoomModes
+}
+
+// RoomModes are the optional per-room behavior toggles mentioned alongside
+// Room in the design; nothing currently enforces them, but the fields are
+// persisted so an admin tool can set them ahead of that enforcement landing.
+type RoomModes struct {
+	InviteOnly bool `json:"invite_only"`
+	Moderated  bool `json:"moderated"`
+}
+
+// RoomRecord is the persisted form of a Room: everything except live
+// membership, which doesn't survive a restart.
+type RoomRecord struct {
+	Topic     string    `json:"topic"`
+	History   []string  `json:"history"`
+	CreatedAt time.Time `json:"created_at"`
+	Modes     RoomModes `json:"modes"`
+}
+
+// RoomInfo is the snapshot-friendly summary of a Room, for StatusSnapshot.
+type RoomInfo struct {
+	Name        string `json:"name"`
+	Topic       string `json:"topic"`
+	MemberCount int    `json:"member_count"`
+}
+
+// restoreRooms rebuilds the runtime room set from the persisted records in
+// h.stats.Rooms, loaded alongside the rest of StatsFile. Membership never
+// persists across a restart.
+func (h *Hub) restoreRooms() {
+	for name, rec := range h.stats.Rooms {
+		h.rooms[name] = &Room{
+			name:      name,
+			topic:     rec.Topic,
+			history:   rec.History,
+			createdAt: rec.CreatedAt,
+			modes:     rec.Modes,
+			members:   make(map[uint64]*Client),
+		}
+	}
+}
+
+// roomBroadcast sends msg to every member of room except excludeID (0 to
+// exclude no one), mirroring Hub.broadcast.
+func (h *Hub) roomBroadcast(room *Room, msg string, excludeID uint64) {
+	for id, m := range room.members {
+		if id != excludeID {
+			m.enqueue(msg, h)
+		}
+	}
+}
+
+// leaveAllRooms removes c from every room it belongs to, announcing its
+// departure to the members left behind. Called from handleLeave once nick
+// is known to be confirmed.
+func (h *Hub) leaveAllRooms(c *Client, nick string) {
+	for _, room := range h.rooms {
+		if _, member := room.members[c.id]; member {
+			delete(room.members, c.id)
+			h.roomBroadcast(room, FormatMsg('P', room.name+" "+nick), 0)
+		}
+	}
+}
+
+// splitFirstField splits s into its first whitespace-delimited field and
+// the (trimmed) remainder, used for the "<room> <rest>" shape shared by O,
+// K, and the topic admin command.
+func splitFirstField(s string) (first, rest string, ok bool) {
+	parts := strings.SplitN(strings.TrimSpace(s), " ", 2)
+	if len(parts) == 0 || parts[0] == "" {
+		return "", "", false
+	}
+	if len(parts) == 1 {
+		return parts[0], "", true
+	}
+	return parts[0], strings.TrimSpace(parts[1]), true
+}
+
+// ---------------------------------------------------------------------------
+// Protocol handlers: R (join room), P (part room), O (room message), K (topic)
+// ---------------------------------------------------------------------------
+
+// onRoomJoin handles "R<name>": joins an existing room, replaying its topic
+// and history to the new member before announcing the join to the rest.
+// Rooms are created by an admin (mkroom), not by joining a nonexistent one.
+func (h *Hub) onRoomJoin(c *Client, content string) {
+	name := strings.TrimSpace(content)
+	room, ok := h.rooms[name]
+	if !ok {
+		c.enqueue(FormatMsg('S', "No such room: "+name), h)
+		return
+	}
+	if _, already := room.members[c.id]; already {
+		return
+	}
+
+	c.mu.Lock()
+	nick := c.nick
+	c.mu.Unlock()
+
+	room.members[c.id] = c
+	if room.topic != "" {
+		c.enqueue(FormatMsg('K', name+" "+room.topic), h)
+	}
+	for _, line := range room.history {
+		c.enqueue(line, h)
+	}
+	h.roomBroadcast(room, FormatMsg('R', name+" "+nick), c.id)
+	slog.Info("room joined", "client", c.id, "nick", nick, "room", name)
+}
+
+// onRoomPart handles "P<name>": leaves a room the client is a member of.
+func (h *Hub) onRoomPart(c *Client, content string) {
+	name := strings.TrimSpace(content)
+	room, ok := h.rooms[name]
+	if !ok {
+		return
+	}
+	if _, member := room.members[c.id]; !member {
+		return
+	}
+
+	c.mu.Lock()
+	nick := c.nick
+	c.mu.Unlock()
+
+	delete(room.members, c.id)
+	h.roomBroadcast(room, FormatMsg('P', name+" "+nick), 0)
+	slog.Info("room parted", "client", c.id, "nick", nick, "room", name)
+}
+
+// onRoomMessage handles "O<name> <text>": routes a message to a room's
+// members only, and appends it to that room's history ring buffer.
+func (h *Hub) onRoomMessage(c *Client, content string) {
+	name, text, ok := splitFirstField(content)
+	if !ok {
+		return
+	}
+	room, exists := h.rooms[name]
+	if !exists {
+		c.enqueue(FormatMsg('S', "No such room: "+name), h)
+		return
+	}
+	if _, member := room.members[c.id]; !member {
+		c.enqueue(FormatMsg('S', "Not in room: "+name), h)
+		return
+	}
+
+	text = SanitizeText(text)
+	if text == "" {
+		return
+	}
+
+	c.mu.Lock()
+	nick := c.nick
+	c.mu.Unlock()
+
+	msg := FormatMsg('O', name+" "+nick+" "+text)
+	room.history = append(room.history, msg)
+	if len(room.history) > h.cfg.HistorySize {
+		room.history = room.history[1:]
+	}
+	if h.historyStore != nil {
+		h.historyStore.Append(HistoryRecord{TS: time.Now(), Nick: nick, Text: text, Room: name})
+	}
+
+	h.roomBroadcast(room, msg, 0)
+	h.metrics.MessagesTotal++
+	h.stats.TotalMessages++
+	h.touchPlayerStat(nick, "message_count")
+}
+
+// onTopicSet handles "K<name> <text>": any current member may set a room's
+// topic, matching this codebase's general stance of trusting confirmed
+// clients (see onStatus) rather than gating every action behind admin auth.
+func (h *Hub) onTopicSet(c *Client, content string) {
+	name, topic, ok := splitFirstField(content)
+	if !ok {
+		return
+	}
+	room, exists := h.rooms[name]
+	if !exists {
+		c.enqueue(FormatMsg('S', "No such room: "+name), h)
+		return
+	}
+	if _, member := room.members[c.id]; !member {
+		c.enqueue(FormatMsg('S', "Not in room: "+name), h)
+		return
+	}
+
+	room.topic = SanitizeText(topic)
+	h.roomBroadcast(room, FormatMsg('K', name+" "+room.topic), 0)
+	h.saveStats()
+	slog.Info("room topic set", "room", name, "client", c.id)
+}
+
+// ---------------------------------------------------------------------------
+// Admin commands: mkroom, rmroom, topic
+// ---------------------------------------------------------------------------
+
+// doMkRoom creates an empty room named name, or reports it already exists.
+func (h *Hub) doMkRoom(actorNick, name string) AdminResult {
+	name = strings.TrimSpace(name)
+	if !ValidateRoomName(name) {
+		return AdminResult{OK: false, Message: "Usage: mkroom <name>"}
+	}
+	if _, exists := h.rooms[name]; exists {
+		return AdminResult{OK: false, Message: "Room already exists: " + name}
+	}
+	h.rooms[name] = &Room{
+		name:      name,
+		members:   make(map[uint64]*Client),
+		createdAt: time.Now(),
+	}
+	h.saveStats()
+	slog.Info("admin mkroom", "admin", actorNick, "room", name)
+	return AdminResult{OK: true, Message: "Created room " + name + "."}
+}
+
+// doRmRoom deletes room name, notifying any members still in it.
+func (h *Hub) doRmRoom(actorNick, name string) AdminResult {
+	name = strings.TrimSpace(name)
+	room, exists := h.rooms[name]
+	if !exists {
+		return AdminResult{OK: false, Message: "No such room: " + name}
+	}
+	h.roomBroadcast(room, FormatMsg('S', "Room "+name+" has been removed."), 0)
+	delete(h.rooms, name)
+	h.saveStats()
+	slog.Info("admin rmroom", "admin", actorNick, "room", name)
+	return AdminResult{OK: true, Message: "Removed room " + name + "."}
+}
+
+// doAdminTopic sets room name's topic from the web console or the 'A' admin
+// command, the same mutation onTopicSet performs for a regular member.
+func (h *Hub) doAdminTopic(actorNick, argsStr string) AdminResult {
+	name, topic, ok := splitFirstField(argsStr)
+	if !ok {
+		return AdminResult{OK: false, Message: "Usage: topic <name> <text>"}
+	}
+	room, exists := h.rooms[name]
+	if !exists {
+		return AdminResult{OK: false, Message: "No such room: " + name}
+	}
+	room.topic = SanitizeText(topic)
+	h.roomBroadcast(room, FormatMsg('K', name+" "+room.topic), 0)
+	h.saveStats()
+	slog.Info("admin topic", "admin", actorNick, "room", name)
+	return AdminResult{OK: true, Message: "Topic set for " + name + "."}
+}
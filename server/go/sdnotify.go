@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// sdNotify sends a sd_notify(3) datagram to systemd, if $NOTIFY_SOCKET is
+// set. It is a no-op (not an error) when the server isn't running under
+// systemd, so callers can fire these unconditionally. No CGo is involved —
+// it's just a write to a unix datagram socket.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// runWatchdog sends periodic WATCHDOG=1 keepalives at half the interval
+// advertised via $WATCHDOG_USEC. The ping only fires if hub.heartbeat has
+// advanced since the last tick, so a wedged hub goroutine stops feeding the
+// watchdog and systemd's restart policy actually kicks in instead of the
+// server silently hanging forever. No-op if systemd didn't request a
+// watchdog (WATCHDOG_USEC unset).
+func runWatchdog(ctx context.Context, hub *Hub) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+
+	interval := time.Duration(usec) * time.Microsecond / 2
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastBeat uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			beat := atomic.LoadUint64(&hub.heartbeat)
+			if beat == lastBeat {
+				slog.Warn("hub heartbeat stalled, withholding systemd watchdog ping")
+				continue
+			}
+			lastBeat = beat
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				slog.Debug("sd_notify watchdog failed", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import "sync"
+
+// sendPriority classifies a queued message for sendQueue's backpressure
+// policy: priorityLow (ordinary chat) is what gets coalesced or dropped
+// first when a client falls behind; priorityHigh (joins, status acks,
+// protocol control, admin/wallops, bans) is kept unless the queue is full
+// even after every low-priority entry has been evicted.
+type sendPriority int
+
+const (
+	sendPriorityLow sendPriority = iota
+	sendPriorityHigh
+)
+
+// messagePriority classifies an outbound message by its wire prefix. 'M'
+// (chat), 'O' (room chat) and 'B' (multiline relay) are ordinary
+// conversation, dropped first from a lagging client's queue; everything
+// else is treated as worth keeping.
+func messagePriority(prefix byte) sendPriority {
+	switch prefix {
+	case 'M', 'O', 'B':
+		return sendPriorityLow
+	default:
+		return sendPriorityHigh
+	}
+}
+
+// queuedMsg is one entry in a sendQueue. nick is only set for 'T' (status)
+// broadcasts, and is what coalescing keys on; framed is the message already
+// rendered through the client's current Framer, ready to write as-is.
+type queuedMsg struct {
+	prefix   byte
+	nick     string
+	priority sendPriority
+	framed   string
+}
+
+// pushOutcome tells Client.enqueue what happened to a pushed message, so it
+// can record the right metric or, in the last-resort case, disconnect the
+// client exactly like the old fixed-size channel always did.
+type pushOutcome struct {
+	forceClose  bool // queue had no room and nothing droppable to make any
+	droppedFull bool // an existing or incoming low-priority message was dropped to stay within capacity/high-water
+	coalesced   bool // replaced an already-queued status broadcast for the same nick
+}
+
+// sendQueue is a client's bounded outbound message queue: a ring buffer
+// guarded by a condition variable, replacing the old fixed chan string.
+// Unlike a channel, push can apply a backpressure policy instead of just
+// force-closing the connection the instant it's full:
+//
+//   - a new 'T' status broadcast for a nick already queued replaces it
+//     in place rather than growing the queue (coalesced)
+//   - once lagging (queue length reached highWater), low-priority traffic
+//     (sendPriorityLow) is refused at push time until the queue has
+//     drained back down to lowWater, so a slow client simply stops
+//     receiving chat without losing anything essential
+//   - if the queue is still at capacity outside of that lagging window,
+//     the oldest low-priority entry is evicted to make room; only a queue
+//     already full of nothing but high-priority traffic falls back to the
+//     old behavior of closing the connection
+//
+// Client.enqueue is the only writer and writePump (via pop) the only
+// reader.
+type sendQueue struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	items     []queuedMsg
+	capacity  int
+	highWater int
+	lowWater  int
+	lagging   bool
+	closed    bool
+}
+
+func newSendQueue(capacity, highWater, lowWater int) *sendQueue {
+	q := &sendQueue{capacity: capacity, highWater: highWater, lowWater: lowWater}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *sendQueue) push(msg queuedMsg) pushOutcome {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return pushOutcome{}
+	}
+
+	if q.lagging && len(q.items) <= q.lowWater {
+		q.lagging = false
+	}
+	if q.lagging && msg.priority == sendPriorityLow {
+		return pushOutcome{droppedFull: true}
+	}
+
+	if msg.prefix == 'T' && msg.nick != "" {
+		for i, existing := range q.items {
+			if existing.prefix == 'T' && existing.nick == msg.nick {
+				q.items[i] = msg
+				q.cond.Signal()
+				return pushOutcome{coalesced: true}
+			}
+		}
+	}
+
+	evicted := false
+	if len(q.items) >= q.capacity {
+		for i, existing := range q.items {
+			if existing.priority == sendPriorityLow {
+				q.items = append(q.items[:i], q.items[i+1:]...)
+				evicted = true
+				break
+			}
+		}
+		if !evicted {
+			return pushOutcome{forceClose: true}
+		}
+	}
+
+	q.items = append(q.items, msg)
+	if len(q.items) >= q.highWater {
+		q.lagging = true
+	}
+	q.cond.Signal()
+	return pushOutcome{droppedFull: evicted}
+}
+
+// pop blocks until a message is available or the queue is closed and
+// drained, in which case ok is false.
+func (q *sendQueue) pop() (msg queuedMsg, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return queuedMsg{}, false
+	}
+	msg = q.items[0]
+	q.items = q.items[1:]
+	if q.lagging && len(q.items) <= q.lowWater {
+		q.lagging = false
+	}
+	return msg, true
+}
+
+// Close marks the queue closed and wakes a blocked pop; queued messages are
+// still drained by pop before it returns ok=false.
+func (q *sendQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,12 +29,134 @@ const (
 	EventMessage
 	EventLeave
 	EventSIGHUP // reload ban list + MOTD
+	EventAdminCommand      // admin mutation dispatched from the web console
+	EventOperatorAuthResult // bcrypt comparison finished off the hub goroutine
 )
 
 type HubEvent struct {
 	Type   HubEventType
 	Client *Client
 	Msg    *ClientMessage
+	Admin  *AdminCommand
+	OpAuth *operatorAuthResult
+}
+
+// AdminCommand is an admin mutation dispatched into the hub from the web
+// console (see adminweb.go), mirroring the kick/ban/motd commands already
+// available over the chat protocol's 'A' prefix. Reply, if non-nil, is sent
+// exactly one AdminResult before the hub moves on to the next event.
+type AdminCommand struct {
+	Kind      string // kick, ban, unban, motd, broadcast
+	Target    string // nick or IP, depending on Kind
+	Text      string // motd text, broadcast text, or ban reason
+	ActorNick string // "webadmin" for web-originated commands
+	ActorIP   string
+	Reply     chan AdminResult
+}
+
+// AdminResult is the outcome of an AdminCommand, returned to the caller
+// (currently only the web console) over AdminCommand.Reply.
+type AdminResult struct {
+	OK      bool
+	Message string
+}
+
+// ---------------------------------------------------------------------------
+// Dashboard events (SSE)
+// ---------------------------------------------------------------------------
+
+// DashboardEvent is a sanitized, JSON-friendly notification pushed to
+// dashboard subscribers over /api/events. Unlike HubEvent it never carries
+// a *Client, so it is safe to serialize and hand to an HTTP goroutine.
+type DashboardEvent struct {
+	Kind string      `json:"kind"` // join, part, challenge, kick, ban, chat-rate
+	Data interface{} `json:"data"`
+}
+
+// dashboardSubBufSize bounds each subscriber's event queue. When full,
+// new events are dropped for that subscriber rather than blocking the hub.
+const dashboardSubBufSize = 32
+
+// Subscribe registers a new dashboard event listener and returns a channel
+// that receives DashboardEvents until Unsubscribe is called. The channel is
+// buffered; slow consumers have stale events dropped instead of stalling
+// the hub goroutine.
+func (h *Hub) Subscribe() <-chan DashboardEvent {
+	ch := make(chan DashboardEvent, dashboardSubBufSize)
+	reply := make(chan struct{})
+	h.subscribeReq <- subscribeRequest{ch: ch, done: reply}
+	<-reply
+	return ch
+}
+
+// Unsubscribe removes a previously subscribed channel. Safe to call once
+// per channel returned by Subscribe.
+func (h *Hub) Unsubscribe(ch <-chan DashboardEvent) {
+	reply := make(chan struct{})
+	h.unsubscribeReq <- unsubscribeRequest{ch: ch, done: reply}
+	<-reply
+}
+
+type subscribeRequest struct {
+	ch   chan DashboardEvent
+	done chan struct{}
+}
+
+type unsubscribeRequest struct {
+	ch   <-chan DashboardEvent
+	done chan struct{}
+}
+
+// drainSubscriptions keeps servicing subscribeReq/unsubscribeReq until
+// stop is closed. Run's ctx.Done case waits on clientWG (and the history
+// store) before it can return, which takes nonzero time with clients still
+// connected; without this, a subscriber — e.g. runStatsdEmitterLoop or
+// watchReloads, both of which Subscribe on the same ctx as the hub and
+// Unsubscribe via defer — would race Run's shutdown and could end up
+// sending on subscribeReq/unsubscribeReq after nothing reads from them
+// again, blocking forever. Servicing requests here instead of just
+// abandoning them keeps every Subscribe/Unsubscribe call safe no matter
+// when it happens relative to shutdown.
+func (h *Hub) drainSubscriptions(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			for ch := range h.subscribers {
+				delete(h.subscribers, ch)
+				close(ch)
+			}
+			return
+		case req := <-h.subscribeReq:
+			h.subscribers[req.ch] = struct{}{}
+			close(req.done)
+		case req := <-h.unsubscribeReq:
+			for ch := range h.subscribers {
+				if ch == req.ch {
+					delete(h.subscribers, ch)
+					close(ch)
+					break
+				}
+			}
+			close(req.done)
+		}
+	}
+}
+
+// publish fans a dashboard event out to every current subscriber. Must only
+// be called from the hub goroutine. A full subscriber buffer means that
+// subscriber is falling behind; we drop the event for it rather than block.
+func (h *Hub) publish(kind string, data interface{}) {
+	if len(h.subscribers) == 0 {
+		return
+	}
+	ev := DashboardEvent{Kind: kind, Data: data}
+	for ch := range h.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			slog.Debug("dashboard subscriber backpressured, dropping event", "kind", kind)
+		}
+	}
 }
 
 // ---------------------------------------------------------------------------
@@ -41,6 +168,10 @@ type StatusSnapshot struct {
 	PlayerCount   int          `json:"player_count"`
 	Players       []PlayerInfo `json:"players"`
 	Metrics       MetricsInfo  `json:"metrics"`
+	// ThrottledIPs is the number of IPs currently blackholed by the
+	// connlimit Throttler for tripping the connect rate limit.
+	ThrottledIPs int        `json:"throttled_ips"`
+	Rooms        []RoomInfo `json:"rooms"`
 }
 
 type PlayerInfo struct {
@@ -52,11 +183,26 @@ type PlayerInfo struct {
 }
 
 type MetricsInfo struct {
-	ConnectionsTotal int64 `json:"connections_total"`
-	MessagesTotal    int64 `json:"messages_total"`
-	ChallengesTotal  int64 `json:"challenges_total"`
-	KicksTotal       int64 `json:"kicks_total"`
-	BansTotal        int64 `json:"bans_total"`
+	ConnectionsTotal    int64 `json:"connections_total"`
+	MessagesTotal       int64 `json:"messages_total"`
+	ChallengesTotal     int64 `json:"challenges_total"`
+	KicksTotal          int64 `json:"kicks_total"`
+	BansTotal           int64 `json:"bans_total"`
+	FloodStrikesTotal   int64 `json:"flood_strikes_total"`
+	NickCollisionsTotal int64 `json:"nick_collisions_total"`
+	// Bans broken down by BanEntry.Type; BansTotal is their sum.
+	BanIPTotal          int64 `json:"ban_ip_total"`
+	BanCIDRTotal        int64 `json:"ban_cidr_total"`
+	BanNickTotal        int64 `json:"ban_nick_total"`
+	BanFingerprintTotal int64 `json:"ban_fingerprint_total"`
+	// ThrottledConnectionsTotal is read from Hub.throttler, which keeps its
+	// own atomic counter since it's updated from the accept goroutine.
+	ThrottledConnectionsTotal int64 `json:"throttled_connections_total"`
+	// Packets a client's sendQueue backpressure policy dropped, by reason
+	// (see sendqueue.go and Client.enqueue/writePump).
+	PacketsDroppedQueueFull    int64 `json:"packets_dropped_queue_full"`
+	PacketsDroppedWriteTimeout int64 `json:"packets_dropped_write_timeout"`
+	PacketsDroppedCoalesced    int64 `json:"packets_dropped_coalesced"`
 }
 
 // ---------------------------------------------------------------------------
@@ -68,6 +214,46 @@ type reservedNick struct {
 	expiry time.Time
 }
 
+// ---------------------------------------------------------------------------
+// Unified ban subsystem (UBAN-style)
+// ---------------------------------------------------------------------------
+
+// Ban target types. ipfingerprint bans match a SHA-256 hash of the
+// connecting IP, for operators who only have a fingerprint on hand (e.g.
+// imported from another server's ban export) and don't want to handle the
+// raw address.
+const (
+	BanTypeIP            = "ip"
+	BanTypeCIDR          = "cidr"
+	BanTypeNick          = "nick"
+	BanTypeIPFingerprint = "ipfingerprint"
+)
+
+// BanEntry is one entry in the unified ban list. Entries are keyed in
+// Hub.bans by Type+":"+Value so the same value can't collide across types.
+type BanEntry struct {
+	Type   string    `json:"type"`
+	Value  string    `json:"value"`
+	Reason string    `json:"reason"`
+	SetBy  string    `json:"set_by"`
+	SetAt  time.Time `json:"set_at"`
+	Expiry time.Time `json:"expiry"` // zero value = permanent
+}
+
+func (b BanEntry) expired(now time.Time) bool {
+	return !b.Expiry.IsZero() && now.After(b.Expiry)
+}
+
+func banKey(banType, value string) string {
+	return banType + ":" + value
+}
+
+// ipFingerprint returns a stable, non-reversible handle for ip.
+func ipFingerprint(ip string) string {
+	sum := sha256.Sum256([]byte(ip))
+	return hex.EncodeToString(sum[:])
+}
+
 // ---------------------------------------------------------------------------
 // Persistent per-player stats
 // ---------------------------------------------------------------------------
@@ -87,6 +273,8 @@ type StatsFile struct {
 	TotalMessages    int64                  `json:"total_messages"`
 	TotalChallenges  int64                  `json:"total_challenges"`
 	Players          map[string]PlayerStats `json:"players"`
+	// Rooms is synced from Hub.rooms before every save; see rooms.go.
+	Rooms map[string]RoomRecord `json:"rooms,omitempty"`
 }
 
 // ---------------------------------------------------------------------------
@@ -100,9 +288,21 @@ type Hub struct {
 	rawStats  chan chan []byte // for /api/stats endpoint
 	clients   map[uint64]*Client
 	nicks     map[string]uint64     // nick → client id
+	// nickSkeletons is the canonical-form registry used when
+	// cfg.NickPolicy == "unicode": NickSkeleton(nick) → client id, so two
+	// visually identical (confusable/homoglyph) nicks can't both be in use.
+	// Unused and left nil in "ascii" mode. See nickpolicy.go.
+	nickSkeletons map[string]uint64
 	reserved  map[string]reservedNick
-	history   []string             // last N chat messages
-	bannedIPs map[string]struct{}
+	bans      map[string]BanEntry  // keyed by banKey(Type, Value)
+	rooms     map[string]*Room     // keyed by Room.name; see rooms.go
+	operators map[string]OperatorAccount // keyed by operator name; see operators.go
+	// historyStore is the durable, seekable chat history backed by bbolt;
+	// nil when cfg.HistoryFile is unset. historyDone closes once its
+	// background goroutine (started in Run) has flushed and closed the
+	// database, so Run's shutdown path can wait on it. See history.go.
+	historyStore *HistoryStore
+	historyDone  chan struct{}
 	motd      string
 	startTime time.Time
 	clientWG  sync.WaitGroup
@@ -110,23 +310,76 @@ type Hub struct {
 	metrics MetricsInfo
 	// persistent stats (owned by hub goroutine)
 	stats StatsFile
+	// dashboard SSE subscribers (owned by hub goroutine)
+	subscribers    map[chan DashboardEvent]struct{}
+	subscribeReq   chan subscribeRequest
+	unsubscribeReq chan unsubscribeRequest
+	// heartbeat is bumped once per Run() loop iteration so the systemd
+	// watchdog (see sdnotify.go) can detect a wedged hub goroutine.
+	heartbeat uint64
+	// messageLatency is written from the hub goroutine and read directly
+	// (via atomics, no channel round-trip) by serveMetrics.
+	messageLatency *Histogram
+	// throttler is consulted by RunTCPListener (outside the hub goroutine)
+	// before a connection is ever turned into an EventJoin; see connlimit.go.
+	throttler *Throttler
+	// cloakSecret is the resolved HMAC key for IP cloaking, or "" if
+	// cloaking is disabled or the secret couldn't be resolved; see
+	// cloak.go. Read-only after newHub, so safe to read unlocked.
+	cloakSecret string
+	// cloakTrustedViewers lets specific viewer IPs/CIDRs see real IPs
+	// through the cloak regardless of operator status — deliberately
+	// separate from throttler's TrustedProxies; see isCloakTrustedViewer
+	// in cloak.go. Read-only after newHub, so safe to read unlocked.
+	cloakTrustedViewers []*net.IPNet
+	// rateLimiter is consulted by handleMessage/onBatch for every
+	// message-producing command; see ratelimit.go.
+	rateLimiter RateLimiter
 }
 
 func newHub(cfg *Config) *Hub {
 	h := &Hub{
-		cfg:       cfg,
-		events:    make(chan HubEvent, 256),
-		snapshots: make(chan chan StatusSnapshot, 16),
-		rawStats:  make(chan chan []byte, 16),
-		clients:   make(map[uint64]*Client),
-		nicks:     make(map[string]uint64),
-		reserved:  make(map[string]reservedNick),
-		bannedIPs: make(map[string]struct{}),
-		startTime: time.Now(),
+		cfg:            cfg,
+		events:         make(chan HubEvent, 256),
+		snapshots:      make(chan chan StatusSnapshot, 16),
+		rawStats:       make(chan chan []byte, 16),
+		clients:        make(map[uint64]*Client),
+		nicks:          make(map[string]uint64),
+		nickSkeletons:  make(map[string]uint64),
+		reserved:       make(map[string]reservedNick),
+		bans:           make(map[string]BanEntry),
+		rooms:          make(map[string]*Room),
+		subscribers:    make(map[chan DashboardEvent]struct{}),
+		subscribeReq:   make(chan subscribeRequest),
+		unsubscribeReq: make(chan unsubscribeRequest),
+		startTime:      time.Now(),
+		messageLatency: &Histogram{},
+		throttler:      NewThrottler(cfg),
+		rateLimiter:    NewWeightedRateLimiter(cfg),
 	}
 	h.stats = h.loadStats()
+	h.restoreRooms()
 	h.motd  = h.loadMOTD()
-	h.loadBanList()
+	h.loadBans()
+	h.loadOperators()
+	if cfg.CloakEnabled {
+		secret, err := resolveCloakSecret(cfg)
+		if err != nil {
+			slog.Error("failed to resolve cloak secret, IP cloaking disabled", "err", err)
+		} else {
+			h.cloakSecret = secret
+		}
+		h.cloakTrustedViewers = parseCloakTrustedViewers(cfg)
+	}
+	if cfg.HistoryFile != "" {
+		hs, err := OpenHistoryStore(cfg)
+		if err != nil {
+			slog.Error("failed to open history store, persistent history disabled", "err", err)
+		} else {
+			h.historyStore = hs
+			h.historyDone = make(chan struct{})
+		}
+	}
 	return h
 }
 
@@ -135,14 +388,29 @@ func newHub(cfg *Config) *Hub {
 // ---------------------------------------------------------------------------
 
 func (h *Hub) Run(ctx context.Context) {
+	if h.historyStore != nil {
+		go func() {
+			h.historyStore.run(ctx)
+			close(h.historyDone)
+		}()
+	}
 	for {
+		atomic.AddUint64(&h.heartbeat, 1)
 		select {
 		case <-ctx.Done():
 			for _, c := range h.clients {
 				c.enqueue(FormatMsg('S', "Server is shutting down."), h)
 				c.conn.Close()
 			}
-			h.clientWG.Wait()
+			drained := make(chan struct{})
+			go func() {
+				h.clientWG.Wait()
+				if h.historyStore != nil {
+					<-h.historyDone
+				}
+				close(drained)
+			}()
+			h.drainSubscriptions(drained)
 			return
 
 		case ev := <-h.events:
@@ -150,13 +418,22 @@ func (h *Hub) Run(ctx context.Context) {
 			case EventJoin:
 				h.handleJoin(ev.Client)
 			case EventMessage:
+				dispatchStart := time.Now()
 				h.handleMessage(ev.Client, ev.Msg)
+				h.messageLatency.Observe(time.Since(dispatchStart).Seconds())
 			case EventLeave:
 				h.handleLeave(ev.Client)
 			case EventSIGHUP:
-				h.loadBanList()
+				h.loadBans()
+				h.reapExpiredBans()
 				h.motd = h.loadMOTD()
-				slog.Info("reloaded ban list and MOTD")
+				h.loadOperators()
+				h.publish("reload", nil)
+				slog.Info("reloaded ban list, MOTD, and operator accounts")
+			case EventAdminCommand:
+				h.handleAdminCommand(ev.Admin)
+			case EventOperatorAuthResult:
+				h.completeOperatorAuth(ev.Client, ev.OpAuth)
 			}
 
 		case reply := <-h.snapshots:
@@ -165,6 +442,20 @@ func (h *Hub) Run(ctx context.Context) {
 		case reply := <-h.rawStats:
 			b, _ := json.MarshalIndent(h.stats, "", "  ")
 			reply <- b
+
+		case req := <-h.subscribeReq:
+			h.subscribers[req.ch] = struct{}{}
+			close(req.done)
+
+		case req := <-h.unsubscribeReq:
+			for ch := range h.subscribers {
+				if ch == req.ch {
+					delete(h.subscribers, ch)
+					close(ch)
+					break
+				}
+			}
+			close(req.done)
 		}
 	}
 }
@@ -201,17 +492,29 @@ func (h *Hub) buildSnapshot() StatusSnapshot {
 		}
 		players = append(players, PlayerInfo{
 			Nick:        nick,
-			IP:          c.ip,
+			IP:          h.publicIP(c.ip),
 			Status:      stat,
 			JoinedAt:    joined.Unix(),
 			IdleSeconds: int64(now.Sub(last).Seconds()),
 		})
 	}
+	blackholedIPs, throttledTotal := h.throttler.Snapshot()
+	metrics := h.metrics
+	metrics.ThrottledConnectionsTotal = throttledTotal
+
+	rooms := make([]RoomInfo, 0, len(h.rooms))
+	for name, room := range h.rooms {
+		rooms = append(rooms, RoomInfo{Name: name, Topic: room.topic, MemberCount: len(room.members)})
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+
 	return StatusSnapshot{
 		UptimeSeconds: int64(now.Sub(h.startTime).Seconds()),
 		PlayerCount:   len(players),
 		Players:       players,
-		Metrics:       h.metrics,
+		Metrics:       metrics,
+		ThrottledIPs:  blackholedIPs,
+		Rooms:         rooms,
 	}
 }
 
@@ -220,9 +523,14 @@ func (h *Hub) buildSnapshot() StatusSnapshot {
 // ---------------------------------------------------------------------------
 
 func (h *Hub) handleJoin(c *Client) {
-	// Ban check
-	if _, banned := h.bannedIPs[c.ip]; banned {
-		slog.Info("rejected banned IP", "ip", c.ip)
+	h.reapExpiredBans()
+
+	// Ban check: ip/cidr/ipfingerprint entries are matchable as soon as the
+	// TCP connection lands. nick-type entries can only be enforced once the
+	// client picks a nick, so they're checked in onNick instead.
+	if ban, banned := h.matchIPBan(c.ip); banned {
+		slog.Info("rejected banned IP", "ip", c.ip, "banType", ban.Type, "reason", ban.Reason)
+		h.throttler.Release(c.ip)
 		go func() {
 			fmt.Fprint(c.conn, FormatMsg('S', "You are banned from this server."))
 			c.conn.Close()
@@ -232,6 +540,7 @@ func (h *Hub) handleJoin(c *Client) {
 
 	if len(h.clients) >= h.cfg.MaxClients {
 		slog.Warn("max clients reached, rejecting", "ip", c.ip)
+		h.throttler.Release(c.ip)
 		go func() {
 			fmt.Fprint(c.conn, FormatMsg('S', "Server is full. Try again later."))
 			c.conn.Close()
@@ -251,7 +560,7 @@ func (h *Hub) handleJoin(c *Client) {
 	slog.Info("client accepted", "client", c.id, "ip", c.ip)
 
 	h.clientWG.Add(2)
-	go func() { defer h.clientWG.Done(); c.writePump() }()
+	go func() { defer h.clientWG.Done(); c.writePump(h) }()
 	go func() { defer h.clientWG.Done(); c.readPump(h, h.cfg) }()
 }
 
@@ -260,6 +569,7 @@ func (h *Hub) handleLeave(c *Client) {
 		return
 	}
 	delete(h.clients, c.id)
+	h.throttler.Release(c.ip)
 
 	c.mu.Lock()
 	confirmed := c.confirmed
@@ -268,6 +578,9 @@ func (h *Hub) handleLeave(c *Client) {
 
 	if confirmed {
 		delete(h.nicks, nick)
+		if h.cfg.NickPolicy == "unicode" {
+			delete(h.nickSkeletons, NickSkeleton(nick))
+		}
 		// Reserve the nick for the grace period
 		if h.cfg.NickReserveSecs > 0 {
 			h.reserved[nick] = reservedNick{
@@ -276,6 +589,8 @@ func (h *Hub) handleLeave(c *Client) {
 			}
 		}
 		h.broadcast(FormatMsg('L', nick), 0)
+		h.leaveAllRooms(c, nick)
+		h.publish("part", map[string]string{"nick": nick})
 		h.touchPlayerStat(nick, "")
 		h.saveStats()
 		slog.Info("client left", "client", c.id, "nick", nick)
@@ -283,7 +598,7 @@ func (h *Hub) handleLeave(c *Client) {
 		slog.Info("unregistered client disconnected", "client", c.id)
 	}
 
-	close(c.send)
+	c.queue.Close()
 }
 
 // ---------------------------------------------------------------------------
@@ -303,23 +618,25 @@ func (h *Hub) handleMessage(c *Client, msg *ClientMessage) {
 		return
 	}
 
-	// Rate-limit message-producing commands
-	if msg.Prefix == 'M' || msg.Prefix == 'C' || msg.Prefix == 'W' || msg.Prefix == 'T' {
-		c.mu.Lock()
-		allowed := c.consumeToken(h.cfg)
-		if !allowed {
-			c.strikes++
-			strikes := c.strikes
-			c.mu.Unlock()
-			slog.Debug("rate limited", "client", c.id, "strike", strikes)
-			if strikes >= h.cfg.Strikes {
-				c.enqueue(FormatMsg('S', "You have been disconnected for flooding."), h)
-				c.conn.Close()
-			}
+	// Rate-limit every command that does real work on a client's behalf.
+	// R/P/K/H (room join/part, topic set, history replay) charge through
+	// here same as the original M/C/W/T/O set always has — H in particular
+	// is the one unauthenticated line that can make the hub walk a large
+	// slice of the history store (see ReplaySince in history.go), so it
+	// must never be free to spam. N is deliberately included too: it's
+	// allowed before a client is even confirmed, and churns the
+	// nick/skeleton maps on every call, so it gets its own (lighter)
+	// default weight rather than being left ungated by omission. E is
+	// handled the same way, already gated above this set's introduction
+	// (see beginOperatorAuth in operators.go) because it triggers a bcrypt
+	// comparison. X (framer negotiation) and L (disconnect) do no
+	// comparable work and stay uncharged; B is weighed once per whole
+	// batch instead of per line (see onBatch).
+	switch msg.Prefix {
+	case 'M', 'C', 'W', 'T', 'O', 'R', 'P', 'K', 'H', 'N', 'E':
+		if !h.applyRateDecision(c, h.rateLimiter.Allow(c, msg.Prefix, len(msg.Content))) {
 			return
 		}
-		c.strikes = 0
-		c.mu.Unlock()
 	}
 
 	switch msg.Prefix {
@@ -329,30 +646,88 @@ func (h *Hub) handleMessage(c *Client, msg *ClientMessage) {
 	case 'W': h.onWhois(c, msg.Content)
 	case 'T': h.onStatus(c, msg.Content)
 	case 'A': h.onAdmin(c, msg.Content)
+	case 'E': h.onOperatorLogin(c, msg.Content)
+	case 'R': h.onRoomJoin(c, msg.Content)
+	case 'P': h.onRoomPart(c, msg.Content)
+	case 'O': h.onRoomMessage(c, msg.Content)
+	case 'K': h.onTopicSet(c, msg.Content)
+	case 'H': h.onHistory(c, msg.Content)
+	case 'B': h.onBatch(c, msg.Content)
+	case 'X': h.onSwitchFramer(c, msg.Content)
 	case 'L': c.conn.Close()
 	default:
 		slog.Debug("unknown prefix", "client", c.id, "prefix", string(msg.Prefix))
 	}
 }
 
+// applyRateDecision carries out the side effects of a RateLimiter verdict
+// and reports whether the caller should still dispatch the message
+// (true only for RateAllow).
+func (h *Hub) applyRateDecision(c *Client, decision RateLimitDecision) bool {
+	switch decision {
+	case RateAllow:
+		return true
+	case RateWarn:
+		h.metrics.FloodStrikesTotal++
+		c.enqueue(FormatMsg('S', "You're sending messages too fast."), h)
+	case RateDrop:
+		h.metrics.FloodStrikesTotal++
+	case RateKick:
+		h.metrics.FloodStrikesTotal++
+		h.throttler.Blackhole(c.ip, time.Duration(h.cfg.RateKickCooldownSecs)*time.Second)
+		c.enqueue(FormatMsg('S', "You have been disconnected for flooding."), h)
+		c.conn.Close()
+	}
+	return false
+}
+
 // ---------------------------------------------------------------------------
 // Protocol handlers
 // ---------------------------------------------------------------------------
 
 func (h *Hub) onNick(c *Client, requested string) {
-	newNick := h.resolveNick(SanitizeNick(requested), c.id, c.ip)
+	sanitize := SanitizeNick
+	if h.cfg.NickPolicy == "unicode" {
+		sanitize = SanitizeUnicodeNick
+	}
+	newNick := h.resolveNick(sanitize(requested), c.id, c.ip)
 
 	c.mu.Lock()
 	confirmed := c.confirmed
 	oldNick   := c.nick
 	c.mu.Unlock()
 
+	if !confirmed {
+		if ban, banned := h.matchNickBan(newNick); banned {
+			slog.Info("rejected banned nick", "nick", newNick, "reason", ban.Reason)
+			c.enqueue(FormatMsg('S', "You are banned from this server."), h)
+			c.conn.Close()
+			return
+		}
+	}
+
+	// Unicode mode: reject nicks that are visually indistinguishable from
+	// one already in use, even though their literal strings differ (e.g.
+	// Cyrillic 'а' vs Latin 'a'). See NickSkeleton/Hub.nickSkeletons.
+	var newSkeleton string
+	if h.cfg.NickPolicy == "unicode" {
+		newSkeleton = NickSkeleton(newNick)
+		if existingID, taken := h.nickSkeletons[newSkeleton]; taken && existingID != c.id {
+			c.enqueue(FormatMsg('S', "That nickname is visually too similar to one already in use."), h)
+			return
+		}
+	}
+
 	if confirmed {
 		if newNick == oldNick {
 			return
 		}
 		delete(h.nicks, oldNick)
 		h.nicks[newNick] = c.id
+		if h.cfg.NickPolicy == "unicode" {
+			delete(h.nickSkeletons, NickSkeleton(oldNick))
+			h.nickSkeletons[newSkeleton] = c.id
+		}
 		c.mu.Lock()
 		c.nick = newNick
 		c.mu.Unlock()
@@ -361,10 +736,14 @@ func (h *Hub) onNick(c *Client, requested string) {
 		slog.Info("nick changed", "client", c.id, "old", oldNick, "new", newNick)
 	} else {
 		h.nicks[newNick] = c.id
+		if h.cfg.NickPolicy == "unicode" {
+			h.nickSkeletons[newSkeleton] = c.id
+		}
 		delete(h.reserved, newNick)
 		c.mu.Lock()
 		c.nick      = newNick
 		c.confirmed = true
+		c.status    = "chat"
 		c.mu.Unlock()
 
 		// Stats
@@ -383,13 +762,15 @@ func (h *Hub) onNick(c *Client, requested string) {
 			otherIP   := other.ip
 			other.mu.Unlock()
 			if other.id != c.id && otherConf {
-				c.enqueue(FormatMsg('J', fmt.Sprintf("%s %s", otherNick, otherIP)), h)
+				c.enqueue(FormatMsg('J', fmt.Sprintf("%s %s", otherNick, h.displayIP(c, otherIP))), h)
 			}
 		}
 
 		// 3. Chat history → new client
-		for _, line := range h.history {
-			c.enqueue(line, h)
+		if h.historyStore != nil {
+			for _, rec := range h.historyStore.ReplayLast("", h.cfg.HistoryMaxReplay) {
+				c.enqueue(formatHistoryRecord(rec), h)
+			}
 		}
 
 		// 4. MOTD
@@ -402,8 +783,19 @@ func (h *Hub) onNick(c *Client, requested string) {
 			}
 		}
 
-		// 5. Announce to everyone else
-		h.broadcast(FormatMsg('J', fmt.Sprintf("%s %s", newNick, c.ip)), c.id)
+		// 5. Announce to everyone else. Each viewer may see a different IP
+		// string for the same joiner (trusted/operator viewers see the real
+		// IP even when cloaking is on), so this can't use the blanket
+		// h.broadcast helper.
+		for _, other := range h.clients {
+			other.mu.Lock()
+			otherConf := other.confirmed
+			other.mu.Unlock()
+			if other.id != c.id && otherConf {
+				other.enqueue(FormatMsg('J', fmt.Sprintf("%s %s", newNick, h.displayIP(other, c.ip))), h)
+			}
+		}
+		h.publish("join", PlayerInfo{Nick: newNick, IP: h.publicIP(c.ip), Status: "chat", JoinedAt: c.joinedAt.Unix()})
 		slog.Info("client registered", "client", c.id, "nick", newNick, "ip", c.ip)
 	}
 }
@@ -419,15 +811,14 @@ func (h *Hub) onMessage(c *Client, text string) {
 
 	msg := FormatMsg('M', fmt.Sprintf("%s %s", nick, text))
 
-	// History
-	h.history = append(h.history, msg)
-	if len(h.history) > h.cfg.HistorySize {
-		h.history = h.history[1:]
+	if h.historyStore != nil {
+		h.historyStore.Append(HistoryRecord{TS: time.Now(), Nick: nick, Text: text})
 	}
 
 	h.broadcast(msg, 0)
 	h.metrics.MessagesTotal++
 	h.stats.TotalMessages++
+	h.publish("chat-rate", map[string]int64{"messages_total": h.metrics.MessagesTotal})
 	h.touchPlayerStat(nick, "message_count")
 	if h.stats.TotalMessages%20 == 0 {
 		h.saveStats()
@@ -449,6 +840,7 @@ func (h *Hub) onChallenge(c *Client, targetNick string) {
 		return
 	}
 	target.enqueue(FormatMsg('C', myNick), h)
+	h.publish("challenge", map[string]string{"from": myNick, "to": targetNick})
 	h.metrics.ChallengesTotal++
 	h.stats.TotalChallenges++
 	h.touchPlayerStat(myNick,     "challenge_sent_count")
@@ -466,7 +858,180 @@ func (h *Hub) onWhois(c *Client, targetNick string) {
 	nick := target.nick
 	ip   := target.ip
 	target.mu.Unlock()
-	c.enqueue(FormatMsg('W', fmt.Sprintf("%s %s", nick, ip)), h)
+	c.enqueue(FormatMsg('W', fmt.Sprintf("%s %s", nick, h.displayIP(c, ip))), h)
+}
+
+// onHistory handles "H<seconds>" (messages newer than now-seconds, any
+// room) and the whois-style "H@<nick> [count]" (a nick's most recent
+// messages, default/cap h.cfg.HistoryMaxReplay), reading from historyStore.
+func (h *Hub) onHistory(c *Client, content string) {
+	if h.historyStore == nil {
+		c.enqueue(FormatMsg('S', "History is not enabled on this server."), h)
+		return
+	}
+
+	if rest, ok := strings.CutPrefix(content, "@"); ok {
+		nick, countStr, _ := splitFirstField(rest)
+		if nick == "" {
+			c.enqueue(FormatMsg('S', "Usage: H@<nick> [count]"), h)
+			return
+		}
+		count := h.cfg.HistoryMaxReplay
+		if countStr != "" {
+			if n, err := strconv.Atoi(countStr); err == nil && n > 0 && n < count {
+				count = n
+			}
+		}
+		for _, rec := range h.historyStore.ReplayForNick(nick, count) {
+			c.enqueue(formatHistoryRecord(rec), h)
+		}
+		return
+	}
+
+	seconds, err := strconv.Atoi(strings.TrimSpace(content))
+	if err != nil || seconds <= 0 {
+		c.enqueue(FormatMsg('S', "Usage: H<seconds> or H@<nick> [count]"), h)
+		return
+	}
+	for _, rec := range h.historyStore.ReplaySince(seconds, h.cfg.HistoryMaxReplay) {
+		c.enqueue(formatHistoryRecord(rec), h)
+	}
+}
+
+// batchIDCounter assigns the server-side id each relayed multiline batch is
+// bracketed with; see relayBatch.
+var batchIDCounter uint64
+
+// onBatch implements the opt-in multiline batch protocol: "Bstart" opens a
+// batch, any number of "Bconcat <line>" messages accumulate its content
+// (capped by cfg.MaxBatchLines/cfg.MaxBatchBytes), and "Bend" relays it
+// atomically. Modeled on IRCv3's draft/multiline, so pasted game logs or
+// long taunts don't trip the one-line-at-a-time flood limiter or the
+// per-line maxLineBytes cap.
+func (h *Hub) onBatch(c *Client, content string) {
+	sub, rest, _ := splitFirstField(content)
+	switch strings.ToLower(sub) {
+	case "start":
+		c.mu.Lock()
+		if c.batchActive {
+			c.mu.Unlock()
+			c.enqueue(FormatMsg('S', "A batch is already in progress; interleaved batches aren't allowed."), h)
+			c.conn.Close()
+			return
+		}
+		c.batchActive = true
+		c.batchLines = nil
+		c.batchBytes = 0
+		c.mu.Unlock()
+
+	case "concat":
+		line := SanitizeText(rest)
+		c.mu.Lock()
+		if !c.batchActive {
+			c.mu.Unlock()
+			c.enqueue(FormatMsg('S', "Bconcat received with no batch in progress."), h)
+			c.conn.Close()
+			return
+		}
+		c.batchBytes += len(line)
+		if len(c.batchLines) >= h.cfg.MaxBatchLines || c.batchBytes > h.cfg.MaxBatchBytes {
+			c.batchActive = false
+			c.batchLines = nil
+			c.batchBytes = 0
+			c.mu.Unlock()
+			c.enqueue(FormatMsg('S', "Batch too large, discarded."), h)
+			c.conn.Close()
+			return
+		}
+		c.batchLines = append(c.batchLines, line)
+		c.mu.Unlock()
+
+	case "end":
+		c.mu.Lock()
+		if !c.batchActive {
+			c.mu.Unlock()
+			c.enqueue(FormatMsg('S', "Bend received with no batch in progress."), h)
+			c.conn.Close()
+			return
+		}
+		lines := c.batchLines
+		batchBytes := c.batchBytes
+		c.batchActive = false
+		c.batchLines = nil
+		c.batchBytes = 0
+		c.mu.Unlock()
+
+		// The whole batch costs a single weighted 'B' charge, levied here
+		// rather than per Bconcat line, same graduated warn/mute/kick path
+		// as a flooded single-line message.
+		if !h.applyRateDecision(c, h.rateLimiter.Allow(c, 'B', batchBytes)) {
+			return
+		}
+
+		c.mu.Lock()
+		nick := c.nick
+		c.mu.Unlock()
+
+		if len(lines) > 0 {
+			h.relayBatch(nick, lines)
+		}
+
+	default:
+		c.enqueue(FormatMsg('S', "Usage: Bstart / Bconcat <text> / Bend"), h)
+	}
+}
+
+// relayBatch broadcasts a completed multiline batch to every confirmed
+// client, bracketed in a "Bbegin <id> <nick>" / "Bend <id>" pair carrying a
+// server-assigned id. Each line is also sent as an ordinary 'M' message, so
+// clients with no multiline support still see it as a normal run of chat
+// lines instead of being left out of the conversation.
+func (h *Hub) relayBatch(nick string, lines []string) {
+	id := atomic.AddUint64(&batchIDCounter, 1)
+	begin := FormatMsg('B', fmt.Sprintf("begin %d %s", id, nick))
+	end := FormatMsg('B', fmt.Sprintf("end %d", id))
+	for _, c := range h.clients {
+		c.mu.Lock()
+		conf := c.confirmed
+		c.mu.Unlock()
+		if !conf {
+			continue
+		}
+		c.enqueue(begin, h)
+		for _, line := range lines {
+			c.enqueue(FormatMsg('M', fmt.Sprintf("%s %s", nick, line)), h)
+		}
+		c.enqueue(end, h)
+	}
+	if h.historyStore != nil {
+		for _, line := range lines {
+			h.historyStore.Append(HistoryRecord{TS: time.Now(), Nick: nick, Text: line})
+		}
+	}
+	h.metrics.MessagesTotal += int64(len(lines))
+	h.stats.TotalMessages += int64(len(lines))
+	h.touchPlayerStat(nick, "message_count")
+	if h.stats.TotalMessages%20 == 0 {
+		h.saveStats()
+	}
+}
+
+// onSwitchFramer handles the 'X' command a client sends to opt into the
+// length-prefixed structured framing (see framer.go) instead of the default
+// line protocol. ('P' was already taken by room-part, hence 'X' rather than
+// a more mnemonic letter.) The acknowledgement below is the last message
+// either side sends or expects in line form — both switch their framer
+// right after, so nothing is left ambiguous about which frame a given byte
+// belongs to.
+func (h *Hub) onSwitchFramer(c *Client, content string) {
+	if strings.TrimSpace(content) != "proto" {
+		c.enqueue(FormatMsg('S', `Unknown framer; only "Xproto" is supported.`), h)
+		return
+	}
+	c.enqueue(FormatMsg('X', "proto"), h)
+	c.mu.Lock()
+	c.framer = LengthPrefixFramer{}
+	c.mu.Unlock()
 }
 
 func (h *Hub) onStatus(c *Client, status string) {
@@ -527,94 +1092,443 @@ func (h *Hub) tryMatchmake(joiner *Client) {
 	}
 }
 
+// onOperatorLogin handles "E<name> <password>": on success it stores name on
+// Client.opName, authorizing subsequent 'A' commands against that operator's
+// privilege set. Failed attempts share Client.strikes with the flood-limit
+// path, so repeated guessing disconnects the client the same way flooding
+// does.
+//
+// The bcrypt comparison itself (tens of ms) runs on its own goroutine rather
+// than here on the hub goroutine — see beginOperatorAuth in operators.go —
+// so a client spamming 'E' can't stall every other client's traffic for the
+// duration of each hash. 'E' is also charged through the rate limiter like
+// any other command (see handleMessage), which bounds how often a single
+// client can trigger a comparison at all.
+func (h *Hub) onOperatorLogin(c *Client, content string) {
+	parts := strings.SplitN(content, " ", 2)
+	c.mu.Lock()
+	nick := c.nick
+	c.mu.Unlock()
+	if len(parts) != 2 || parts[0] == "" {
+		c.enqueue(FormatMsg('S', "Usage: E<name> <password>"), h)
+		return
+	}
+	h.beginOperatorAuth(c, nick, parts[0], parts[1])
+}
+
+// completeOperatorAuth applies the outcome of a beginOperatorAuth comparison
+// once it comes back as an EventOperatorAuthResult. The client may have left
+// while the comparison was in flight, so it's looked up in h.clients before
+// any of its state is touched.
+func (h *Hub) completeOperatorAuth(c *Client, result *operatorAuthResult) {
+	if _, exists := h.clients[c.id]; !exists {
+		return
+	}
+
+	if !result.ok {
+		c.mu.Lock()
+		c.strikes++
+		strikes := c.strikes
+		c.mu.Unlock()
+		h.metrics.FloodStrikesTotal++
+		c.enqueue(FormatMsg('S', "Invalid operator credentials."), h)
+		slog.Warn("failed operator login", "nick", result.nick, "ip", c.ip, "strike", strikes)
+		if strikes >= h.cfg.Strikes {
+			c.enqueue(FormatMsg('S', "You have been disconnected for too many failed attempts."), h)
+			c.conn.Close()
+		}
+		return
+	}
+
+	c.mu.Lock()
+	c.opName = result.name
+	c.strikes = 0
+	c.mu.Unlock()
+	c.enqueue(FormatMsg('S', "Authenticated as operator "+result.name+"."), h)
+	h.wallops(fmt.Sprintf("%s authenticated as operator %s.", result.nick, result.name))
+	slog.Info("operator login", "nick", result.nick, "operator", result.name, "ip", c.ip)
+}
+
+// onAdmin handles "A<cmd> [args]". Authorization no longer comes from an
+// inline password (see onOperatorLogin / Client.opName): the client must
+// have already authenticated via 'E', and the authenticated operator's
+// Privileges must cover the requested command.
 func (h *Hub) onAdmin(c *Client, content string) {
-	if h.cfg.AdminPassword == "" {
+	if len(h.operators) == 0 {
 		c.enqueue(FormatMsg('S', "Admin commands are disabled on this server."), h)
 		return
 	}
 
-	parts := strings.SplitN(content, " ", 3)
-	if len(parts) < 2 {
-		c.enqueue(FormatMsg('S', "Usage: A<password> <kick|ban|reload|motd> [args]"), h)
+	c.mu.Lock()
+	opName := c.opName
+	actorNick := c.nick
+	c.mu.Unlock()
+
+	if opName == "" {
+		c.enqueue(FormatMsg('S', "You must authenticate first: E<name> <password>"), h)
+		return
+	}
+	acct, exists := h.operators[opName]
+	if !exists {
+		c.enqueue(FormatMsg('S', "Operator account no longer exists."), h)
 		return
 	}
 
-	password, cmd := parts[0], strings.ToLower(parts[1])
+	parts := strings.SplitN(content, " ", 2)
+	cmd := strings.ToLower(strings.TrimSpace(parts[0]))
+	if cmd == "" {
+		c.enqueue(FormatMsg('S', "Usage: A <kick|ban|unban|bans|howtoban|reload|motd|mkroom|rmroom|topic|wallops|whoisop> [args]"), h)
+		return
+	}
 	args := ""
-	if len(parts) > 2 {
-		args = strings.TrimSpace(parts[2])
+	if len(parts) > 1 {
+		args = strings.TrimSpace(parts[1])
 	}
 
-	if password != h.cfg.AdminPassword {
-		c.mu.Lock()
-		nick := c.nick
-		c.mu.Unlock()
-		c.enqueue(FormatMsg('S', "Invalid admin password."), h)
-		slog.Warn("failed admin attempt", "nick", nick, "ip", c.ip)
+	if priv, needed := adminCommandPrivilege(cmd); needed && !acct.has(priv) {
+		c.enqueue(FormatMsg('S', "Operator "+opName+" lacks the '"+priv+"' privilege."), h)
 		return
 	}
 
+	var result AdminResult
 	switch cmd {
 	case "kick":
-		h.adminKick(c, args)
+		result = h.doKick(actorNick, c.ip, args)
 	case "ban":
-		h.adminBan(c, args)
+		result = h.doBan(actorNick, c.ip, args)
+	case "unban":
+		result = h.doUnban(actorNick, c.ip, args)
+	case "bans":
+		result = h.doBansList()
+	case "howtoban":
+		result = h.doHowToBan(args)
 	case "reload":
-		h.loadBanList()
+		h.loadBans()
+		h.reapExpiredBans()
 		h.motd = h.loadMOTD()
-		c.enqueue(FormatMsg('S', "Reloaded ban list and MOTD."), h)
-		c.mu.Lock(); slog.Info("admin reload", "nick", c.nick); c.mu.Unlock()
+		h.loadOperators()
+		h.publish("reload", nil)
+		h.wallops(actorNick + " reloaded the ban list, MOTD, and operator accounts.")
+		slog.Info("admin reload", "admin", actorNick)
+		result = AdminResult{OK: true, Message: "Reloaded ban list, MOTD, and operator accounts."}
+	case "motd":
+		result = h.doMOTD(actorNick, c.ip, args)
+	case "mkroom":
+		result = h.doMkRoom(actorNick, args)
+	case "rmroom":
+		result = h.doRmRoom(actorNick, args)
+	case "topic":
+		result = h.doAdminTopic(actorNick, args)
+	case "wallops":
+		result = h.doWallops(opName, actorNick, args)
+	case "whoisop":
+		result = h.doWhoisOp(args)
+	default:
+		result = AdminResult{OK: false, Message: "Unknown command: " + cmd}
+	}
+	c.enqueue(FormatMsg('S', result.Message), h)
+}
+
+// handleAdminCommand runs an AdminCommand dispatched from the web console
+// (see adminweb.go) through the same mutation logic the chat protocol's 'A'
+// prefix uses, and reports the outcome back over cmd.Reply.
+func (h *Hub) handleAdminCommand(cmd *AdminCommand) {
+	var result AdminResult
+	switch cmd.Kind {
+	case "kick":
+		result = h.doKick(cmd.ActorNick, cmd.ActorIP, cmd.Target)
+	case "ban":
+		result = h.doBan(cmd.ActorNick, cmd.ActorIP, cmd.Target)
+	case "unban":
+		result = h.doUnban(cmd.ActorNick, cmd.ActorIP, cmd.Target)
 	case "motd":
-		h.motd = args
-		c.enqueue(FormatMsg('S', "MOTD updated."), h)
+		result = h.doMOTD(cmd.ActorNick, cmd.ActorIP, cmd.Text)
+	case "broadcast":
+		result = h.doBroadcast(cmd.ActorNick, cmd.ActorIP, cmd.Text)
 	default:
-		c.enqueue(FormatMsg('S', "Unknown command: "+cmd), h)
+		result = AdminResult{OK: false, Message: "Unknown command: " + cmd.Kind}
+	}
+	if cmd.Reply != nil {
+		cmd.Reply <- result
 	}
 }
 
-func (h *Hub) adminKick(admin *Client, targetNick string) {
+// doKick disconnects targetNick. actorNick/actorIP identify who asked,
+// for the audit log.
+func (h *Hub) doKick(actorNick, actorIP, targetNick string) AdminResult {
 	target := h.clientByNick(targetNick)
 	if target == nil {
-		admin.enqueue(FormatMsg('S', "No such user: "+targetNick), h)
-		return
+		return AdminResult{OK: false, Message: "No such user: " + targetNick}
 	}
 	target.enqueue(FormatMsg('S', "You have been kicked by an administrator."), h)
 	target.conn.Close()
 	h.metrics.KicksTotal++
-	admin.enqueue(FormatMsg('S', "Kicked "+targetNick+"."), h)
-	admin.mu.Lock(); slog.Info("admin kick", "admin", admin.nick, "target", targetNick); admin.mu.Unlock()
+	h.publish("kick", map[string]string{"nick": targetNick})
+	h.wallops(fmt.Sprintf("%s kicked %s.", actorNick, targetNick))
+	slog.Info("admin kick", "admin", actorNick, "adminIP", actorIP, "target", targetNick)
+	return AdminResult{OK: true, Message: "Kicked " + targetNick + "."}
 }
 
-func (h *Hub) adminBan(admin *Client, arg string) {
-	ip := arg
-	// Resolve nick → IP if needed
-	target := h.clientByNick(arg)
-	if target != nil {
-		ip = target.ip
-		h.adminKick(admin, arg)
+// doBan adds a ban entry for "<target> [duration] [reason...]". target is
+// classified by classifyBanTarget into an ip/cidr/nick/ipfingerprint entry;
+// if it resolves to a currently-connected nick, that client is also kicked
+// immediately so the ban takes effect without waiting for a reconnect.
+func (h *Hub) doBan(actorNick, actorIP, argsStr string) AdminResult {
+	fields := strings.Fields(argsStr)
+	if len(fields) == 0 {
+		return AdminResult{OK: false, Message: "Usage: ban <target> [duration] [reason]"}
+	}
+	target, rest := fields[0], fields[1:]
+
+	var expiry time.Time
+	if len(rest) > 0 {
+		if d, err := time.ParseDuration(rest[0]); err == nil {
+			expiry = time.Now().Add(d)
+			rest = rest[1:]
+		}
+	}
+	reason := strings.Join(rest, " ")
+
+	banType, value := classifyBanTarget(target)
+	if banType == BanTypeNick {
+		if conn := h.clientByNick(value); conn != nil {
+			h.doKick(actorNick, actorIP, value)
+		}
+	}
+
+	h.bans[banKey(banType, value)] = BanEntry{
+		Type: banType, Value: value, Reason: reason,
+		SetBy: actorNick, SetAt: time.Now(), Expiry: expiry,
 	}
+	h.saveBans()
 
-	h.bannedIPs[ip] = struct{}{}
 	h.metrics.BansTotal++
+	switch banType {
+	case BanTypeIP:
+		h.metrics.BanIPTotal++
+	case BanTypeCIDR:
+		h.metrics.BanCIDRTotal++
+	case BanTypeNick:
+		h.metrics.BanNickTotal++
+	case BanTypeIPFingerprint:
+		h.metrics.BanFingerprintTotal++
+	}
+	h.publish("ban", map[string]string{"type": banType, "value": value})
+	h.wallops(fmt.Sprintf("%s banned %s (%s).", actorNick, value, banType))
 
-	if h.cfg.BanFile != "" {
-		f, err := os.OpenFile(h.cfg.BanFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err == nil {
-			fmt.Fprintln(f, ip)
-			f.Close()
-		} else {
-			slog.Warn("could not write ban file", "err", err)
+	slog.Info("admin ban", "admin", actorNick, "adminIP", actorIP, "type", banType, "value", value, "expiry", expiry)
+	return AdminResult{OK: true, Message: fmt.Sprintf("Banned %s (%s).", value, banType)}
+}
+
+// doUnban removes the ban entry matching target, classified the same way
+// doBan classifies it.
+func (h *Hub) doUnban(actorNick, actorIP, target string) AdminResult {
+	banType, value := classifyBanTarget(target)
+	key := banKey(banType, value)
+	if _, banned := h.bans[key]; !banned {
+		return AdminResult{OK: false, Message: "Not banned: " + target}
+	}
+	delete(h.bans, key)
+	h.saveBans()
+	h.wallops(fmt.Sprintf("%s unbanned %s.", actorNick, target))
+	slog.Info("admin unban", "admin", actorNick, "adminIP", actorIP, "type", banType, "value", value)
+	return AdminResult{OK: true, Message: "Unbanned " + target + "."}
+}
+
+// doBansList returns a one-line summary of every active ban, for the chat
+// admin command (no web route exposes this yet).
+func (h *Hub) doBansList() AdminResult {
+	if len(h.bans) == 0 {
+		return AdminResult{OK: true, Message: "No active bans."}
+	}
+	lines := make([]string, 0, len(h.bans))
+	for _, b := range h.bans {
+		expiry := "permanent"
+		if !b.Expiry.IsZero() {
+			expiry = b.Expiry.Format(time.RFC3339)
 		}
+		lines = append(lines, fmt.Sprintf("%s:%s by %s, %s", b.Type, b.Value, b.SetBy, expiry))
 	}
+	sort.Strings(lines)
+	return AdminResult{OK: true, Message: strings.Join(lines, "; ")}
+}
 
-	admin.enqueue(FormatMsg('S', "Banned "+ip+"."), h)
-	admin.mu.Lock(); slog.Info("admin ban", "admin", admin.nick, "ip", ip); admin.mu.Unlock()
+// doHowToBan inspects nick's currently-connected client and suggests the
+// narrowest ban that's still effective: the exact IP normally, or a CIDR
+// covering the address's NAT/proxy-sharing block when that IP is already
+// serving other concurrent sessions (an exact-IP ban wouldn't fully
+// discourage a shared NAT/proxy). The CIDR width is branched by address
+// family the same way connlimit.go's throttleKey is — /24 for IPv4, /64
+// for IPv6 — since a flat /24 on an IPv6 address covers only its first 3
+// bytes (roughly 2^104 addresses), nowhere near a meaningful suggestion.
+func (h *Hub) doHowToBan(nick string) AdminResult {
+	target := h.clientByNick(nick)
+	if target == nil {
+		return AdminResult{OK: false, Message: "No such user: " + nick}
+	}
+	ip := target.ip
+
+	sessions := 0
+	for _, other := range h.clients {
+		if other.id != target.id && other.ip == ip {
+			sessions++
+		}
+	}
+	if sessions == 0 {
+		return AdminResult{OK: true, Message: fmt.Sprintf("%s connects from %s; suggest: ban %s", nick, ip, ip)}
+	}
+	if cidr := banSuggestionCIDR(ip); cidr != "" {
+		return AdminResult{OK: true, Message: fmt.Sprintf(
+			"%s shares %s with %d other session(s); suggest: ban %s", nick, ip, sessions, cidr)}
+	}
+	return AdminResult{OK: true, Message: fmt.Sprintf("%s connects from %s; suggest: ban %s", nick, ip, ip)}
+}
+
+// banSuggestionCIDR returns the CIDR doHowToBan should suggest for ip: a
+// /24 for IPv4, a /64 for IPv6 (matching throttleKey's bucket width in
+// connlimit.go), or "" if ip doesn't parse.
+func banSuggestionCIDR(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// classifyBanTarget works out which BanEntry.Type a ban/unban target string
+// names: "fp:<hex>" for an IP fingerprint, a CIDR, a literal IP, or
+// otherwise a nick.
+func classifyBanTarget(target string) (banType, value string) {
+	if v, ok := strings.CutPrefix(target, "fp:"); ok {
+		return BanTypeIPFingerprint, v
+	}
+	if strings.Contains(target, "/") {
+		if _, _, err := net.ParseCIDR(target); err == nil {
+			return BanTypeCIDR, target
+		}
+	}
+	if net.ParseIP(target) != nil {
+		return BanTypeIP, target
+	}
+	return BanTypeNick, target
+}
+
+// matchIPBan reports whether ip is covered by an ip, cidr, or ipfingerprint
+// ban entry.
+func (h *Hub) matchIPBan(ip string) (BanEntry, bool) {
+	if b, ok := h.bans[banKey(BanTypeIP, ip)]; ok {
+		return b, true
+	}
+	if b, ok := h.bans[banKey(BanTypeIPFingerprint, ipFingerprint(ip))]; ok {
+		return b, true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return BanEntry{}, false
+	}
+	for _, b := range h.bans {
+		if b.Type != BanTypeCIDR {
+			continue
+		}
+		if _, ipnet, err := net.ParseCIDR(b.Value); err == nil && ipnet.Contains(parsed) {
+			return b, true
+		}
+	}
+	return BanEntry{}, false
+}
+
+// matchNickBan reports whether nick is covered by a nick ban entry.
+func (h *Hub) matchNickBan(nick string) (BanEntry, bool) {
+	b, ok := h.bans[banKey(BanTypeNick, nick)]
+	return b, ok
+}
+
+// reapExpiredBans drops ban entries past their Expiry. Called on every join
+// and on SIGHUP, per the rest of the hub's lazy-reload conventions.
+func (h *Hub) reapExpiredBans() {
+	now := time.Now()
+	removed := 0
+	for key, b := range h.bans {
+		if b.expired(now) {
+			delete(h.bans, key)
+			removed++
+		}
+	}
+	if removed > 0 {
+		slog.Info("reaped expired bans", "count", removed)
+		h.saveBans()
+	}
+}
+
+// doMOTD replaces the message of the day shown to newly joining clients.
+func (h *Hub) doMOTD(actorNick, actorIP, text string) AdminResult {
+	h.motd = text
+	h.wallops(actorNick + " updated the MOTD.")
+	slog.Info("admin motd", "admin", actorNick, "adminIP", actorIP)
+	return AdminResult{OK: true, Message: "MOTD updated."}
+}
+
+// doWallops sends a WALLOPS-style notice to every currently-authenticated
+// operator, prefixed with the sending operator's name.
+func (h *Hub) doWallops(opName, actorNick, text string) AdminResult {
+	text = SanitizeText(strings.TrimSpace(text))
+	if text == "" {
+		return AdminResult{OK: false, Message: "Usage: wallops <text>"}
+	}
+	h.wallops(fmt.Sprintf("[%s] %s", opName, text))
+	slog.Info("operator wallops", "operator", opName, "nick", actorNick)
+	return AdminResult{OK: true, Message: "Wallops sent."}
+}
+
+// doWhoisOp reports which operator name targetNick is authenticated as, if
+// any.
+func (h *Hub) doWhoisOp(targetNick string) AdminResult {
+	targetNick = strings.TrimSpace(targetNick)
+	target := h.clientByNick(targetNick)
+	if target == nil {
+		return AdminResult{OK: false, Message: "No such user: " + targetNick}
+	}
+	target.mu.Lock()
+	opName := target.opName
+	target.mu.Unlock()
+	if opName == "" {
+		return AdminResult{OK: true, Message: targetNick + " is not authenticated as an operator."}
+	}
+	return AdminResult{OK: true, Message: targetNick + " is authenticated as operator " + opName + "."}
+}
+
+// doBroadcast sends a server notice to every confirmed client.
+func (h *Hub) doBroadcast(actorNick, actorIP, text string) AdminResult {
+	text = SanitizeText(strings.TrimSpace(text))
+	if text == "" {
+		return AdminResult{OK: false, Message: "Broadcast text must not be empty."}
+	}
+	h.broadcast(FormatMsg('S', text), 0)
+	slog.Info("admin broadcast", "admin", actorNick, "adminIP", actorIP)
+	return AdminResult{OK: true, Message: "Broadcast sent."}
 }
 
 // ---------------------------------------------------------------------------
 // Helpers
 // ---------------------------------------------------------------------------
 
+// wallops sends text, wrapped in the 'V' wire prefix, to every
+// currently-authenticated operator (WALLOPS-style, per IRC convention).
+func (h *Hub) wallops(text string) {
+	msg := FormatMsg('V', text)
+	for _, c := range h.clients {
+		c.mu.Lock()
+		isOp := c.opName != ""
+		c.mu.Unlock()
+		if isOp {
+			c.enqueue(msg, h)
+		}
+	}
+}
+
 func (h *Hub) broadcast(msg string, excludeID uint64) {
 	for _, c := range h.clients {
 		c.mu.Lock()
@@ -641,8 +1555,11 @@ func (h *Hub) resolveNick(base string, myID uint64, myIP string) string {
 			candidate = base
 		} else {
 			suffix := fmt.Sprintf("_%d", i)
-			if len(base)+len(suffix) > 20 {
-				candidate = base[:20-len(suffix)] + suffix
+			// Rune-counted, not byte-counted, so truncating a Unicode-mode
+			// nick (see cfg.NickPolicy) can't split a multi-byte rune.
+			baseRunes := []rune(base)
+			if len(baseRunes)+len(suffix) > 20 {
+				candidate = string(baseRunes[:20-len(suffix)]) + suffix
 			} else {
 				candidate = base + suffix
 			}
@@ -665,6 +1582,9 @@ func (h *Hub) resolveNick(base string, myID uint64, myIP string) string {
 			}
 		}
 
+		if i > 0 {
+			h.metrics.NickCollisionsTotal++
+		}
 		return candidate
 	}
 }
@@ -703,6 +1623,15 @@ func (h *Hub) saveStats() {
 	if h.cfg.StatsFile == "" {
 		return
 	}
+	h.stats.Rooms = make(map[string]RoomRecord, len(h.rooms))
+	for name, room := range h.rooms {
+		h.stats.Rooms[name] = RoomRecord{
+			Topic:     room.topic,
+			History:   room.history,
+			CreatedAt: room.createdAt,
+			Modes:     room.modes,
+		}
+	}
 	tmp := h.cfg.StatsFile + ".tmp"
 	f, err := os.Create(tmp)
 	if err != nil {
@@ -760,7 +1689,10 @@ func (h *Hub) loadMOTD() string {
 // Ban list
 // ---------------------------------------------------------------------------
 
-func (h *Hub) loadBanList() {
+// loadBans reads the JSON ban store written by saveBans. Missing or
+// unparsable files just leave the in-memory ban list empty, same as a
+// missing stats file in loadStats.
+func (h *Hub) loadBans() {
 	if h.cfg.BanFile == "" {
 		return
 	}
@@ -770,28 +1702,62 @@ func (h *Hub) loadBanList() {
 	}
 	defer f.Close()
 
-	newBans := make(map[string]struct{})
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			newBans[line] = struct{}{}
-		}
+	var entries []BanEntry
+	if err := json.NewDecoder(f).Decode(&entries); err != nil {
+		slog.Warn("could not parse ban file", "err", err)
+		return
+	}
+	bans := make(map[string]BanEntry, len(entries))
+	for _, b := range entries {
+		bans[banKey(b.Type, b.Value)] = b
+	}
+	h.bans = bans
+	slog.Info("loaded bans", "count", len(bans))
+}
+
+// saveBans writes the ban store as indented JSON via the same
+// write-to-tmp-then-rename pattern as saveStats, so a crash mid-write can't
+// leave a truncated ban file behind.
+func (h *Hub) saveBans() {
+	if h.cfg.BanFile == "" {
+		return
+	}
+	entries := make([]BanEntry, 0, len(h.bans))
+	for _, b := range h.bans {
+		entries = append(entries, b)
+	}
+	tmp := h.cfg.BanFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		slog.Warn("could not write ban file", "err", err)
+		return
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(entries); err != nil {
+		f.Close()
+		slog.Warn("could not encode ban file", "err", err)
+		return
+	}
+	f.Close()
+	if err := os.Rename(tmp, h.cfg.BanFile); err != nil {
+		slog.Warn("could not rename ban file", "err", err)
 	}
-	h.bannedIPs = newBans
-	slog.Info("loaded banned IPs", "count", len(newBans))
 }
 
 // ---------------------------------------------------------------------------
 // TCP listener
 // ---------------------------------------------------------------------------
 
-func RunTCPListener(ctx context.Context, cfg *Config, hub *Hub, wg *sync.WaitGroup) error {
+func RunTCPListener(ctx context.Context, cfg *Config, hub *Hub, wg *sync.WaitGroup, tlsConfig *tls.Config) error {
 	ln, err := net.Listen("tcp", cfg.ChatAddr)
 	if err != nil {
 		return err
 	}
-	slog.Info("MortalNet chat server listening", "addr", ln.Addr())
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	slog.Info("MortalNet chat server listening", "addr", ln.Addr(), "tls", tlsConfig != nil)
 
 	go func() { <-ctx.Done(); ln.Close() }()
 
@@ -811,12 +1777,25 @@ func RunTCPListener(ctx context.Context, cfg *Config, hub *Hub, wg *sync.WaitGro
 			}
 
 			ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
-			c := newClient(conn, ip)
+
+			// Checked before the client ever touches the hub, so a host
+			// flooding connections never gets past Accept into a TLS
+			// handshake or EventJoin dispatch. No reply is written on
+			// refusal: for a TLS listener, writing would itself trigger
+			// the handshake this check exists to avoid paying for.
+			if ok, reason := hub.throttler.Allow(ip); !ok {
+				slog.Warn("connection throttled", "ip", ip, "reason", reason)
+				conn.Close()
+				continue
+			}
+
+			c := newClient(conn, ip, hub.cfg)
 
 			select {
 			case hub.events <- HubEvent{Type: EventJoin, Client: c}:
 			default:
 				slog.Warn("hub event queue full, rejecting", "ip", ip)
+				hub.throttler.Release(ip)
 				fmt.Fprint(conn, FormatMsg('S', "Server busy. Try again later."))
 				conn.Close()
 			}
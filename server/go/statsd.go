@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// MetricsSink is the minimal surface RunStatsdEmitter needs. It exists so
+// tests can assert on emitted packets without opening a real UDP socket.
+type MetricsSink interface {
+	Counter(name string, delta int64)
+	Gauge(name string, value float64)
+	Close() error
+}
+
+// udpStatsdSink writes statsd/DogStatsD packets ("name:value|type") to a UDP
+// endpoint. UDP is connectionless and best-effort by design here: a dropped
+// metrics packet must never slow down or block the hub.
+type udpStatsdSink struct {
+	conn   *net.UDPConn
+	prefix string
+}
+
+// newUDPStatsdSink dials (but does not connect a TCP-style handshake to) the
+// given statsd UDP endpoint.
+func newUDPStatsdSink(addr, prefix string) (*udpStatsdSink, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("resolve statsd addr: %w", err)
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, fmt.Errorf("dial statsd addr: %w", err)
+	}
+	return &udpStatsdSink{conn: conn, prefix: prefix}, nil
+}
+
+func (s *udpStatsdSink) Counter(name string, delta int64) {
+	s.send(fmt.Sprintf("%s.%s:%d|c", s.prefix, name, delta))
+}
+
+func (s *udpStatsdSink) Gauge(name string, value float64) {
+	s.send(fmt.Sprintf("%s.%s:%g|g", s.prefix, name, value))
+}
+
+func (s *udpStatsdSink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *udpStatsdSink) send(packet string) {
+	if _, err := s.conn.Write([]byte(packet)); err != nil {
+		slog.Debug("statsd write failed", "err", err)
+	}
+}
+
+// dashboardKindToCounter maps a DashboardEvent.Kind to the statsd counter
+// name it should bump, mirroring the events the hub already counts.
+var dashboardKindToCounter = map[string]string{
+	"join":      "connections",
+	"part":      "disconnects",
+	"challenge": "challenges",
+	"kick":      "kicks",
+	"ban":       "bans",
+	"chat-rate": "messages",
+}
+
+// RunStatsdEmitter feeds hub activity into a statsd/DogStatsD endpoint. It
+// subscribes to the same dashboard event stream the SSE dashboard uses for
+// counters, and periodically polls Hub.Snapshot for gauges. It blocks until
+// ctx is cancelled, then flushes nothing further (UDP has no buffered state
+// to drain) and returns.
+func RunStatsdEmitter(ctx context.Context, cfg *Config, hub *Hub) error {
+	sink, err := newUDPStatsdSink(cfg.StatsdAddr, cfg.StatsdPrefix)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+
+	slog.Info("statsd emitter started", "addr", cfg.StatsdAddr, "prefix", cfg.StatsdPrefix)
+	runStatsdEmitterLoop(ctx, cfg, hub, sink)
+	return nil
+}
+
+// runStatsdEmitterLoop is split out from RunStatsdEmitter so tests can drive
+// it against a fake MetricsSink instead of a real UDP socket.
+//
+// Subscribe/Unsubscribe on the same ctx the hub itself shuts down on used to
+// be able to deadlock the whole process: Hub.Run stopped servicing
+// subscribeReq/unsubscribeReq the instant ctx.Done fired, so the deferred
+// Unsubscribe here could send on a channel nobody would ever read from
+// again. Run now keeps draining those requests until every client and the
+// history store have finished shutting down, so this Subscribe/Unsubscribe
+// pair is safe regardless of how it races with shutdown.
+func runStatsdEmitterLoop(ctx context.Context, cfg *Config, hub *Hub, sink MetricsSink) {
+	sub := hub.Subscribe()
+	defer hub.Unsubscribe(sub)
+
+	interval := time.Duration(cfg.StatsdFlushInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			if name, known := dashboardKindToCounter[ev.Kind]; known {
+				sink.Counter(name, 1)
+			}
+
+		case <-ticker.C:
+			snap := hub.Snapshot()
+			sink.Gauge("active_players", float64(snap.PlayerCount))
+			sink.Gauge("uptime_seconds", float64(snap.UptimeSeconds))
+		}
+	}
+}
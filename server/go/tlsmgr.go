@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// buildTLSConfig constructs the *tls.Config shared by the chat listener and
+// the dashboard, in one of two modes:
+//
+//   - ACME: cfg.ACMEDomains is non-empty, certificates are obtained and
+//     renewed automatically via Let's Encrypt. The returned http.Handler
+//     must be served on :80 for HTTP-01 challenges.
+//   - Static cert: cfg.TLSCert/cfg.TLSKey point at a cert/key pair on disk
+//     that is re-read whenever the hub processes a SIGHUP.
+//
+// Returns (nil, nil, nil) when neither is configured, so callers fall back
+// to plaintext listeners.
+func buildTLSConfig(ctx context.Context, cfg *Config, hub *Hub) (*tls.Config, http.Handler, error) {
+	switch {
+	case len(cfg.ACMEDomains) > 0:
+		mgr := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+		}
+		slog.Info("ACME enabled", "domains", cfg.ACMEDomains, "cacheDir", cfg.ACMECacheDir)
+		return mgr.TLSConfig(), mgr.HTTPHandler(nil), nil
+
+	case cfg.TLSCert != "" && cfg.TLSKey != "":
+		reloader, err := newCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		go reloader.watchReloads(ctx, hub)
+		return &tls.Config{GetCertificate: reloader.getCertificate}, nil, nil
+
+	default:
+		return nil, nil, nil
+	}
+}
+
+// certReloader serves a static TLS certificate/key pair that can be swapped
+// out while the server is running, so operators can rotate certs without a
+// restart.
+type certReloader struct {
+	certPath, keyPath string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("load TLS cert/key: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watchReloads re-reads the cert/key pair whenever the hub publishes a
+// "reload" dashboard event — the same SIGHUP path that already reloads the
+// ban list and MOTD (see Hub.Run's EventSIGHUP case).
+func (r *certReloader) watchReloads(ctx context.Context, hub *Hub) {
+	sub := hub.Subscribe()
+	defer hub.Unsubscribe(sub)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			if ev.Kind != "reload" {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				slog.Warn("TLS cert reload failed, keeping previous certificate", "err", err)
+			} else {
+				slog.Info("TLS certificate reloaded")
+			}
+		}
+	}
+}
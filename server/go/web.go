@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"runtime"
 	"strings"
 	"time"
 )
@@ -14,12 +16,11 @@ const dashboardHTML = `<!DOCTYPE html>
 <html lang="en">
 <head>
 <meta charset="utf-8">
-<meta http-equiv="refresh" content="10">
 <title>MortalNet Status</title>
 <style>
   body { font-family: monospace; background: #111; color: #ccc; padding: 2em; }
   h1 { color: #f80; }
-  table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+  table { border-collapse: collapse; width: 100%%; margin-bottom: 2em; }
   th, td { border: 1px solid #444; padding: 0.4em 0.8em; text-align: left; }
   th { color: #f80; background: #222; }
   tr:nth-child(even) { background: #1a1a1a; }
@@ -28,39 +29,126 @@ const dashboardHTML = `<!DOCTYPE html>
   .status-away  { color: #fa0; }
   .status-game  { color: #88f; }
   .status-queue { color: #f88; }
+  #live { color: #666; }
+  #live.connected { color: #8f8; }
 </style>
 </head>
 <body>
 <h1>MortalNet Status</h1>
-<p class="meta">Uptime: %ds &mdash; Players online: %d</p>
-<table>
+<p class="meta">Uptime: <span id="uptime">%d</span>s &mdash; Players online: <span id="count">%d</span> &mdash; <span id="live">live: connecting&hellip;</span></p>
+<table id="players">
 <tr><th>Nick</th><th>IP</th><th>Status</th><th>Idle (s)</th></tr>
 %s
 </table>
+<script>
+// Progressive enhancement: the table above renders fine without JS (plain
+// HTML, no auto-refresh meta tag). If EventSource is available we subscribe
+// to /api/events and patch the table in place instead of reloading the page.
+(function () {
+  if (typeof EventSource === "undefined") return;
+
+  var liveEl = document.getElementById("live");
+  var es = new EventSource("/api/events");
+
+  es.onopen = function () {
+    liveEl.textContent = "live: connected";
+    liveEl.className = "connected";
+    refresh();
+  };
+  es.onerror = function () {
+    liveEl.textContent = "live: reconnecting…";
+    liveEl.className = "";
+  };
+  // Any hub event (join/part/challenge/kick/ban/chat-rate) can change the
+  // player table, so just re-pull the JSON snapshot and diff it in place
+  // rather than trying to apply each event kind individually.
+  es.onmessage = function () { refresh(); };
+
+  function refresh() {
+    fetch("/api/status").then(function (r) { return r.json(); }).then(render);
+  }
+
+  function render(snap) {
+    document.getElementById("uptime").textContent = snap.uptime_seconds;
+    document.getElementById("count").textContent = snap.player_count;
+    var table = document.getElementById("players");
+    while (table.rows.length > 1) table.deleteRow(1);
+    if (snap.players.length === 0) {
+      var empty = table.insertRow(-1);
+      var cell = empty.insertCell(0);
+      cell.colSpan = 4;
+      cell.textContent = "No players online";
+      return;
+    }
+    snap.players.forEach(function (p) {
+      var row = table.insertRow(-1);
+      row.insertCell(0).textContent = p.nick;
+      row.insertCell(1).textContent = p.ip;
+      var statusCell = row.insertCell(2);
+      statusCell.textContent = p.status;
+      statusCell.className = "status-" + p.status;
+      row.insertCell(3).textContent = p.idle_seconds;
+    });
+  }
+})();
+</script>
 </body>
 </html>`
 
 // RunWebServer starts the HTTP dashboard and blocks until ctx is cancelled.
-func RunWebServer(ctx context.Context, cfg *Config, hub *Hub) error {
+func RunWebServer(ctx context.Context, cfg *Config, hub *Hub, tlsConfig *tls.Config, acmeHandler http.Handler) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/",           makeHandler(hub, serveIndex))
 	mux.HandleFunc("/api/status", makeHandler(hub, serveStatus))
 	mux.HandleFunc("/api/stats",  makeHandler(hub, serveStats))
+	mux.HandleFunc("/api/events", makeHandler(hub, serveEvents))
 	mux.HandleFunc("/metrics",    makeHandler(hub, serveMetrics))
 	mux.HandleFunc("/healthz",    makeHandler(hub, serveHealth))
+	mux.HandleFunc("/ws",         serveWS(hub))
+
+	// Admin console: a password-gated login issuing an HMAC-signed session
+	// cookie, guarding a handful of CSRF-protected mutation endpoints.
+	sessions := newSessionStore()
+	go runSessionSweeper(ctx, sessions)
+	mux.HandleFunc("/login",          serveLogin(cfg, sessions))
+	mux.HandleFunc("/api/kick",       makeAdminMutationHandler(hub, sessions, "kick"))
+	mux.HandleFunc("/api/ban",        makeAdminMutationHandler(hub, sessions, "ban"))
+	mux.HandleFunc("/api/unban",      makeAdminMutationHandler(hub, sessions, "unban"))
+	mux.HandleFunc("/api/motd",       makeAdminMutationHandler(hub, sessions, "motd"))
+	mux.HandleFunc("/api/broadcast",  makeAdminMutationHandler(hub, sessions, "broadcast"))
 
 	srv := &http.Server{
 		Addr:         cfg.WebAddr,
 		Handler:      mux,
+		TLSConfig:    tlsConfig,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	var acmeSrv *http.Server
+	if acmeHandler != nil {
+		// ACME HTTP-01 challenges must be answered on plain :80.
+		acmeSrv = &http.Server{Addr: ":80", Handler: acmeHandler}
+		go func() {
+			slog.Info("ACME HTTP-01 challenge listener starting", "addr", acmeSrv.Addr)
+			if err := acmeSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("ACME challenge listener error", "err", err)
+			}
+		}()
+	}
+
 	errCh := make(chan error, 1)
 	go func() {
-		slog.Info("MortalNet dashboard listening", "addr", cfg.WebAddr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("MortalNet dashboard listening", "addr", cfg.WebAddr, "tls", tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			// Cert/key come from tlsConfig (GetCertificate), not from disk here.
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 	}()
@@ -71,6 +159,9 @@ func RunWebServer(ctx context.Context, cfg *Config, hub *Hub) error {
 	case <-ctx.Done():
 		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
+		if acmeSrv != nil {
+			acmeSrv.Shutdown(shutCtx)
+		}
 		return srv.Shutdown(shutCtx)
 	}
 }
@@ -125,34 +216,138 @@ func serveStats(w http.ResponseWriter, r *http.Request, hub *Hub) {
 	}
 }
 
+// serveEvents streams hub state changes as Server-Sent Events so the
+// dashboard can update in real-time instead of polling. Each event is a
+// DashboardEvent JSON blob; the client just uses it to trigger a re-fetch
+// of /api/status rather than trying to apply deltas itself.
+func serveEvents(w http.ResponseWriter, r *http.Request, hub *Hub) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	sub := hub.Subscribe()
+	defer hub.Unsubscribe(sub)
+
+	// Periodic comment keeps idle proxies/browsers from timing out the
+	// connection even when the hub is quiet.
+	keepalive := time.NewTicker(20 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Kind, data)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// serveMetrics emits OpenMetrics 1.0.0 text exposition
+// (https://openmetrics.io/), including a histogram of hub message-dispatch
+// latency recorded lock-free off the hot path (see Histogram in
+// histogram.go) and per-status connection gauges derived from the snapshot.
 func serveMetrics(w http.ResponseWriter, r *http.Request, hub *Hub) {
 	snap := hub.Snapshot()
 	m    := snap.Metrics
+	lat  := hub.messageLatency.Snapshot()
+
+	byState := map[string]int{"chat": 0, "away": 0, "game": 0, "queue": 0}
+	for _, p := range snap.Players {
+		byState[p.Status]++
+	}
+
+	// OpenMetrics counters: the HELP/TYPE lines name the metric family
+	// without its "_total" suffix, and the sample line appends "_total".
 	var b strings.Builder
-	fmt.Fprintf(&b, "# HELP mortalnet_connections_total Total TCP connections accepted\n")
-	fmt.Fprintf(&b, "# TYPE mortalnet_connections_total counter\n")
-	fmt.Fprintf(&b, "mortalnet_connections_total %d\n\n", m.ConnectionsTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_connections Total TCP connections accepted\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_connections counter\n")
+	fmt.Fprintf(&b, "mortalnet_connections_total %d\n", m.ConnectionsTotal)
 	fmt.Fprintf(&b, "# HELP mortalnet_active_players Currently registered players\n")
 	fmt.Fprintf(&b, "# TYPE mortalnet_active_players gauge\n")
-	fmt.Fprintf(&b, "mortalnet_active_players %d\n\n", snap.PlayerCount)
-	fmt.Fprintf(&b, "# HELP mortalnet_messages_total Total chat messages processed\n")
-	fmt.Fprintf(&b, "# TYPE mortalnet_messages_total counter\n")
-	fmt.Fprintf(&b, "mortalnet_messages_total %d\n\n", m.MessagesTotal)
-	fmt.Fprintf(&b, "# HELP mortalnet_challenges_total Total challenges sent\n")
-	fmt.Fprintf(&b, "# TYPE mortalnet_challenges_total counter\n")
-	fmt.Fprintf(&b, "mortalnet_challenges_total %d\n\n", m.ChallengesTotal)
-	fmt.Fprintf(&b, "# HELP mortalnet_kicks_total Total admin kicks\n")
-	fmt.Fprintf(&b, "# TYPE mortalnet_kicks_total counter\n")
-	fmt.Fprintf(&b, "mortalnet_kicks_total %d\n\n", m.KicksTotal)
-	fmt.Fprintf(&b, "# HELP mortalnet_bans_total Total admin bans\n")
-	fmt.Fprintf(&b, "# TYPE mortalnet_bans_total counter\n")
-	fmt.Fprintf(&b, "mortalnet_bans_total %d\n\n", m.BansTotal)
+	fmt.Fprintf(&b, "mortalnet_active_players %d\n", snap.PlayerCount)
+
+	fmt.Fprintf(&b, "# HELP mortalnet_connections_by_state Currently connected players grouped by status\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_connections_by_state gauge\n")
+	for _, state := range []string{"chat", "away", "game", "queue"} {
+		fmt.Fprintf(&b, "mortalnet_connections_by_state{state=%q} %d\n", state, byState[state])
+	}
+
+	fmt.Fprintf(&b, "# HELP mortalnet_messages Total chat messages processed\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_messages counter\n")
+	fmt.Fprintf(&b, "mortalnet_messages_total %d\n", m.MessagesTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_challenges Total challenges sent\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_challenges counter\n")
+	fmt.Fprintf(&b, "mortalnet_challenges_total %d\n", m.ChallengesTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_kicks Total admin kicks\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_kicks counter\n")
+	fmt.Fprintf(&b, "mortalnet_kicks_total %d\n", m.KicksTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_bans Total admin bans\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_bans counter\n")
+	fmt.Fprintf(&b, "mortalnet_bans_total %d\n", m.BansTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_flood_strikes Total rate-limit strikes issued\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_flood_strikes counter\n")
+	fmt.Fprintf(&b, "mortalnet_flood_strikes_total %d\n", m.FloodStrikesTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_nick_collisions Total nick choices that had to be disambiguated\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_nick_collisions counter\n")
+	fmt.Fprintf(&b, "mortalnet_nick_collisions_total %d\n", m.NickCollisionsTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_throttled_connections Total connections refused by the per-IP connection throttler\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_throttled_connections counter\n")
+	fmt.Fprintf(&b, "mortalnet_throttled_connections_total %d\n", m.ThrottledConnectionsTotal)
+	fmt.Fprintf(&b, "# HELP mortalnet_throttled_ips IPs currently blackholed by the connection throttler\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_throttled_ips gauge\n")
+	fmt.Fprintf(&b, "mortalnet_throttled_ips %d\n", snap.ThrottledIPs)
+	fmt.Fprintf(&b, "# HELP mortalnet_packets_dropped Total outbound packets dropped by a client's send-queue backpressure policy, by reason\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_packets_dropped counter\n")
+	fmt.Fprintf(&b, "mortalnet_packets_dropped_total{reason=\"queue_full\"} %d\n", m.PacketsDroppedQueueFull)
+	fmt.Fprintf(&b, "mortalnet_packets_dropped_total{reason=\"write_timeout\"} %d\n", m.PacketsDroppedWriteTimeout)
+	fmt.Fprintf(&b, "mortalnet_packets_dropped_total{reason=\"coalesced\"} %d\n", m.PacketsDroppedCoalesced)
+
+	fmt.Fprintf(&b, "# HELP mortalnet_message_latency_seconds Hub dispatch time per chat message\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_message_latency_seconds histogram\n")
+	for i, upper := range histogramBuckets {
+		fmt.Fprintf(&b, "mortalnet_message_latency_seconds_bucket{le=\"%g\"} %d\n", upper, lat.Buckets[i])
+	}
+	fmt.Fprintf(&b, "mortalnet_message_latency_seconds_bucket{le=\"+Inf\"} %d\n", lat.Count)
+	fmt.Fprintf(&b, "mortalnet_message_latency_seconds_sum %g\n", lat.Sum)
+	fmt.Fprintf(&b, "mortalnet_message_latency_seconds_count %d\n", lat.Count)
+
 	fmt.Fprintf(&b, "# HELP mortalnet_uptime_seconds Server uptime in seconds\n")
 	fmt.Fprintf(&b, "# TYPE mortalnet_uptime_seconds gauge\n")
 	fmt.Fprintf(&b, "mortalnet_uptime_seconds %d\n", snap.UptimeSeconds)
 
+	fmt.Fprintf(&b, "# HELP mortalnet_build_info Build metadata, value is always 1\n")
+	fmt.Fprintf(&b, "# TYPE mortalnet_build_info gauge\n")
+	fmt.Fprintf(&b, "mortalnet_build_info{version=%q,commit=%q,go_version=%q} 1\n",
+		buildVersion, buildCommit, runtime.Version())
+
+	fmt.Fprint(&b, "# EOF\n")
+
 	body := []byte(b.String())
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	if r.Method != http.MethodHead {
 		w.Write(body)
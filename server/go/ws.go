@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn adapts a *websocket.Conn to the lineConn interface, so Client's
+// existing readPump and fmt.Fprint-based writePump work unchanged over a
+// browser WebSocket: each inbound text frame is served as one
+// newline-terminated "line" (matching what LineFramer expects from raw
+// TCP), and each outbound line is re-framed as one text message. Since
+// Write always strips to a single text frame, a client that switches to
+// LengthPrefixFramer (see framer.go) over a WebSocket isn't supported yet —
+// only raw TCP/TLS clients can negotiate it today.
+type wsConn struct {
+	ws  *websocket.Conn
+	buf bytes.Reader
+}
+
+func newWsConn(ws *websocket.Conn) *wsConn {
+	return &wsConn{ws: ws}
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	if c.buf.Len() == 0 {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.buf.Reset(append(data, '\n'))
+	}
+	return c.buf.Read(p)
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\r\n")
+	if err := c.ws.WriteMessage(websocket.TextMessage, line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error                           { return c.ws.Close() }
+func (c *wsConn) SetReadDeadline(t time.Time) error       { return c.ws.SetReadDeadline(t) }
+func (c *wsConn) SetWriteDeadline(t time.Time) error      { return c.ws.SetWriteDeadline(t) }
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  maxLineBytes,
+	WriteBufferSize: maxLineBytes,
+	// Openmortal clients are expected to come from arbitrary browser
+	// origins (there's no notion of a single "our site" origin), same
+	// trust model as the raw TCP/TLS listener accepting any peer.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// serveWS upgrades a GET /ws request to a WebSocket and feeds the resulting
+// connection into the hub exactly like RunTCPListener does for raw TCP:
+// throttle by IP, wrap in a Client, and hand it off via EventJoin. The hub
+// itself never learns the transport was a WebSocket.
+func serveWS(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+		if ok, reason := hub.throttler.Allow(ip); !ok {
+			slog.Warn("websocket connection throttled", "ip", ip, "reason", reason)
+			http.Error(w, "Too many connections", http.StatusTooManyRequests)
+			return
+		}
+
+		ws, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			slog.Debug("websocket upgrade failed", "ip", ip, "err", err)
+			hub.throttler.Release(ip)
+			return
+		}
+
+		c := newClient(newWsConn(ws), ip, hub.cfg)
+		select {
+		case hub.events <- HubEvent{Type: EventJoin, Client: c}:
+		default:
+			slog.Warn("hub event queue full, rejecting websocket client", "ip", ip)
+			hub.throttler.Release(ip)
+			ws.Close()
+		}
+	}
+}